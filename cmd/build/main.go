@@ -0,0 +1,67 @@
+// Command build compiles the Lambda functions for the provided.al2023 runtime,
+// each into dist/<function>/bootstrap where infrastructure/ picks them up.
+// Run it from the repository root:
+//
+//	go run ./cmd/build                    # every function under cmd/lambda-*
+//	go run ./cmd/build lambda-router      # only the named ones
+//
+// Building lambda-router, lambda-authorizer and lambda-session-sweeper is
+// enough for a deployment with LAMBDA_BUILD=router.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	out := flag.String("out", "dist", "directory to write the functions to")
+	arch := flag.String("arch", "amd64", `architecture of the functions: "amd64" or "arm64"`)
+	flag.Parse()
+
+	functions := flag.Args()
+	if len(functions) == 0 {
+		dirs, err := filepath.Glob(filepath.Join("cmd", "lambda-*"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(dirs) == 0 {
+			log.Fatal("no cmd/lambda-* directories; run from the repository root")
+		}
+		for _, dir := range dirs {
+			functions = append(functions, filepath.Base(dir))
+		}
+	}
+
+	for _, function := range functions {
+		if err := build(function, *out, *arch); err != nil {
+			log.Fatalf("%s: %v", function, err)
+		}
+	}
+}
+
+// build compiles one function, statically and without the RPC shim that only
+// the go1.x runtime used
+func build(function, out, arch string) error {
+	if !strings.HasPrefix(function, "lambda-") {
+		return fmt.Errorf("not a Lambda function; expected a cmd/lambda-* name")
+	}
+	output := filepath.Join(out, function, "bootstrap")
+
+	cmd := exec.Command("go", "build", "-tags", "lambda.norpc", "-trimpath", "-ldflags", "-s -w",
+		"-o", output, "./"+filepath.ToSlash(filepath.Join("cmd", function)))
+	cmd.Env = append(os.Environ(), "GOOS=linux", "GOARCH="+arch, "CGO_ENABLED=0")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return err
+	}
+
+	log.Printf("built %s", output)
+	return nil
+}
@@ -0,0 +1,60 @@
+// Command expire-plaintext-tokens deletes the sessions and refresh tokens
+// stored under the raw token, from before only token hashes were stored.
+// Those rows are only honored until the raw-key lookup is dropped, so this
+// is a one-off cleanup to run against each stage 24 hours after upgrading:
+//
+//	go run ./cmd/expire-plaintext-tokens -stage beta
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+
+	"agendum/internal/store/dynamo"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+func main() {
+	stage := flag.String("stage", "", "stage whose tables to clean up, such as beta")
+	dryRun := flag.Bool("dry-run", false, "count the rows without deleting them")
+	flag.Parse()
+	if *stage == "" {
+		log.Fatal("-stage is required")
+	}
+
+	ctx := context.Background()
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	db := dynamo.New(dynamodb.NewFromConfig(cfg), dynamo.TablesForStage(*stage))
+
+	sessions, err := db.Sessions.ListUnhashed(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	refreshTokens, err := db.RefreshTokens.ListUnhashed(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *dryRun {
+		log.Printf("%s: would delete %d plaintext sessions and %d plaintext refresh tokens", *stage, len(sessions), len(refreshTokens))
+		return
+	}
+
+	for _, s := range sessions {
+		if err := db.Sessions.Delete(ctx, s.Token); err != nil {
+			log.Fatal(err)
+		}
+	}
+	for _, rt := range refreshTokens {
+		if err := db.RefreshTokens.Delete(ctx, rt.Token); err != nil {
+			log.Fatal(err)
+		}
+	}
+	log.Printf("%s: deleted %d plaintext sessions and %d plaintext refresh tokens", *stage, len(sessions), len(refreshTokens))
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"agendum/internal/api/authorizer"
+	"agendum/internal/store/dynamo"
+	"agendum/pkg/secrets"
+
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+func main() {
+	if err := secrets.Load(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+	db, err := dynamo.NewFromEnv(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+	authorizer.SetStore(db)
+	lambda.Start(authorizer.Handler)
+}
@@ -0,0 +1,32 @@
+// Command lambda-router serves every route of the API from one Lambda
+// function, dispatching on the method and resource of each API Gateway event.
+// The token authorizer and the session sweeper stay separate functions.
+package main
+
+import (
+	"context"
+	"log"
+
+	"agendum/internal/api"
+	"agendum/internal/api/authn"
+	"agendum/internal/api/rest"
+	"agendum/internal/store/dynamo"
+	"agendum/pkg/secrets"
+
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+func main() {
+	if err := secrets.Load(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+	if err := authn.CheckConfig(); err != nil {
+		log.Fatal(err)
+	}
+	db, err := dynamo.NewFromEnv(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+	api.SetStore(db)
+	lambda.Start(rest.Lambda(api.Handle))
+}
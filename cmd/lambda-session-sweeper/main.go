@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"agendum/internal/store"
+	"agendum/internal/store/dynamo"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+var db *store.Store
+
+// handler runs on a schedule and takes care of sessions written before the
+// numeric expiry attribute existed, which DynamoDB TTL never deletes: expired
+// ones are deleted and the rest get the attribute so TTL picks them up.
+func handler(ctx context.Context, event events.CloudWatchEvent) error {
+	legacy, err := db.Sessions.ListWithoutExpiry(ctx)
+	if err != nil {
+		return err
+	}
+
+	deleted, backfilled := 0, 0
+	for _, s := range legacy {
+		expireTime, err := time.Parse(time.RFC3339, s.ExpiresAt)
+
+		if err != nil || time.Now().After(expireTime) {
+			if err := db.Sessions.Delete(ctx, s.Token); err != nil {
+				return err
+			}
+			deleted++
+			continue
+		}
+
+		err = db.Sessions.SetExpiry(ctx, s.Token, expireTime.Unix())
+		if err == store.ErrNotFound {
+			// Deleted since the scan
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		backfilled++
+	}
+
+	log.Printf("session sweep: deleted %d expired legacy sessions, backfilled expiry on %d", deleted, backfilled)
+	return nil
+}
+
+func main() {
+	var err error
+	db, err = dynamo.NewFromEnv(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+	lambda.Start(handler)
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"agendum/internal/api/rest"
+	"agendum/internal/api/teamsettings"
+	"agendum/internal/store/dynamo"
+
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+func main() {
+	db, err := dynamo.NewFromEnv(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+	teamsettings.SetStore(db)
+	lambda.Start(rest.Lambda(teamsettings.Handler))
+}
@@ -0,0 +1,286 @@
+// Command mock-oidc is a minimal OpenID Connect provider for trying out
+// single sign-on locally. It supports discovery, the authorization code flow
+// with S256 PKCE and RS256 ID tokens, and logs in whoever fills in its form.
+// Never use it outside development.
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"html/template"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	keyID   = "mock-oidc-1"
+	codeTTL = time.Minute
+)
+
+type grant struct {
+	clientID      string
+	redirectURI   string
+	challenge     string
+	nonce         string
+	email         string
+	emailVerified bool
+	givenName     string
+	familyName    string
+	expiresAt     time.Time
+}
+
+type provider struct {
+	issuer   string
+	clientID string
+	key      *rsa.PrivateKey
+
+	mu     sync.Mutex
+	grants map[string]grant
+}
+
+var loginForm = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Mock OIDC login</title></head>
+<body>
+<h1>Mock OIDC login</h1>
+<form method="post">
+{{range $name, $value := .Query}}<input type="hidden" name="{{$name}}" value="{{index $value 0}}">
+{{end}}<p><label>Email <input name="email" value="{{.Email}}" required></label></p>
+<p><label>First name <input name="given_name" value="Dev"></label></p>
+<p><label>Last name <input name="family_name" value="User"></label></p>
+<p><label><input type="checkbox" name="email_verified" value="true" checked> Email verified</label></p>
+<p><button type="submit">Log in</button></p>
+</form>
+</body>
+</html>
+`))
+
+func main() {
+	addr := flag.String("addr", ":9400", "address to listen on")
+	issuer := flag.String("issuer", "http://localhost:9400", "issuer URL, as Agendum's OIDC_ISSUER")
+	clientID := flag.String("client-id", "agendum-local", "client ID to accept, as Agendum's OIDC_CLIENT_ID")
+	email := flag.String("email", "", "log in as this email without showing the form")
+	flag.Parse()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Fatal(err)
+	}
+	p := &provider{
+		issuer:   strings.TrimSuffix(*issuer, "/"),
+		clientID: *clientID,
+		key:      key,
+		grants:   make(map[string]grant),
+	}
+
+	http.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	http.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) { p.authorize(w, r, *email) })
+	http.HandleFunc("/token", p.token)
+	http.HandleFunc("/jwks", p.jwks)
+
+	log.Printf("mock OIDC provider %s listening on %s", p.issuer, *addr)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func tokenError(w http.ResponseWriter, code, description string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code, "error_description": description})
+}
+
+func (p *provider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                p.issuer,
+		"authorization_endpoint":                p.issuer + "/authorize",
+		"token_endpoint":                        p.issuer + "/token",
+		"jwks_uri":                              p.issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"scopes_supported":                      []string{"openid", "email", "profile"},
+	})
+}
+
+// authorize shows the login form, or with -email logs straight in, then
+// redirects back to the client with a code
+func (p *provider) authorize(w http.ResponseWriter, r *http.Request, autoEmail string) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	params := r.Form
+
+	redirectURI := params.Get("redirect_uri")
+	switch {
+	case params.Get("client_id") != p.clientID:
+		http.Error(w, "unknown client_id", http.StatusBadRequest)
+		return
+	case redirectURI == "":
+		http.Error(w, "redirect_uri is required", http.StatusBadRequest)
+		return
+	case params.Get("response_type") != "code":
+		http.Error(w, "only response_type=code is supported", http.StatusBadRequest)
+		return
+	case params.Get("code_challenge") == "" || params.Get("code_challenge_method") != "S256":
+		http.Error(w, "S256 PKCE is required", http.StatusBadRequest)
+		return
+	}
+
+	email := params.Get("email")
+	if r.Method == http.MethodGet {
+		if autoEmail == "" {
+			loginForm.Execute(w, map[string]interface{}{"Query": r.URL.Query(), "Email": params.Get("login_hint")})
+			return
+		}
+		email = autoEmail
+		params.Set("email_verified", "true")
+	}
+	if email == "" {
+		http.Error(w, "email is required", http.StatusBadRequest)
+		return
+	}
+
+	code := randomString()
+	p.mu.Lock()
+	p.grants[code] = grant{
+		clientID:      p.clientID,
+		redirectURI:   redirectURI,
+		challenge:     params.Get("code_challenge"),
+		nonce:         params.Get("nonce"),
+		email:         email,
+		emailVerified: params.Get("email_verified") == "true",
+		givenName:     params.Get("given_name"),
+		familyName:    params.Get("family_name"),
+		expiresAt:     time.Now().Add(codeTTL),
+	}
+	p.mu.Unlock()
+
+	target, err := url.Parse(redirectURI)
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	query := target.Query()
+	query.Set("code", code)
+	query.Set("state", params.Get("state"))
+	target.RawQuery = query.Encode()
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+// token redeems a code once, checking the PKCE verifier against the
+// challenge it was issued for
+func (p *provider) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, "invalid_request", err.Error())
+		return
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		tokenError(w, "unsupported_grant_type", "only authorization_code is supported")
+		return
+	}
+
+	code := r.PostForm.Get("code")
+	p.mu.Lock()
+	g, ok := p.grants[code]
+	delete(p.grants, code)
+	p.mu.Unlock()
+
+	verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	switch {
+	case !ok || time.Now().After(g.expiresAt):
+		tokenError(w, "invalid_grant", "unknown or expired code")
+		return
+	case r.PostForm.Get("client_id") != g.clientID || r.PostForm.Get("redirect_uri") != g.redirectURI:
+		tokenError(w, "invalid_grant", "client_id or redirect_uri doesn't match the authorization request")
+		return
+	case base64.RawURLEncoding.EncodeToString(verifier[:]) != g.challenge:
+		tokenError(w, "invalid_grant", "code_verifier doesn't match code_challenge")
+		return
+	}
+
+	now := time.Now()
+	idToken, err := p.sign(map[string]interface{}{
+		"iss":            p.issuer,
+		"sub":            subjectFor(g.email),
+		"aud":            g.clientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"nonce":          g.nonce,
+		"email":          g.email,
+		"email_verified": g.emailVerified,
+		"given_name":     g.givenName,
+		"family_name":    g.familyName,
+		"name":           strings.TrimSpace(g.givenName + " " + g.familyName),
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+func (p *provider) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": keyID,
+			"n":   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+		}},
+	})
+}
+
+func (p *provider) sign(claims map[string]interface{}) (string, error) {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": keyID})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// subjectFor gives each email a stable subject across restarts
+func subjectFor(email string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(email)))
+	return base64.RawURLEncoding.EncodeToString(sum[:16])
+}
+
+func randomString() string {
+	raw := make([]byte, 32)
+	rand.Read(raw)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"agendum/internal/api"
+	"agendum/internal/api/authorizer"
+	"agendum/internal/api/rest"
+	"agendum/pkg/auth"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// methodArnPrefix stands in for the region, account, API ID and stage of
+// the ARNs the authorizer sees
+const methodArnPrefix = "arn:aws:execute-api:local:000000000000:local/local/"
+
+var corsHeaders = map[string]string{
+	"Access-Control-Allow-Origin":  "*",
+	"Access-Control-Allow-Headers": "Content-Type,X-Amz-Date,Authorization,X-Api-Key,X-Amz-Security-Token",
+}
+
+// gateway does what API Gateway does in front of the Lambda functions: it
+// finds the route, answers CORS preflights, runs the token authorizer on
+// protected routes and enforces the policy it returns, then calls the
+// route's handler through the net/http adapter of internal/api/rest
+type gateway struct{}
+
+func (gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	resource, params, routes := api.Match(r.URL.Path)
+	if len(routes) == 0 {
+		writeJSON(w, http.StatusNotFound, map[string]string{"message": "Not found"})
+		return
+	}
+
+	methods := []string{}
+	var route *api.Route
+	for i := range routes {
+		methods = append(methods, routes[i].Method)
+		if routes[i].Method == r.Method {
+			route = &routes[i]
+		}
+	}
+	if r.Method == http.MethodOptions {
+		for name, value := range corsHeaders {
+			w.Header().Set(name, value)
+		}
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(append(methods, "OPTIONS"), ","))
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if route == nil {
+		w.Header().Set("Allow", strings.Join(methods, ", "))
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"message": "Method not allowed"})
+		return
+	}
+
+	request, err := rest.FromHTTP(r, resource, params)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"message": "Could not read the request body"})
+		return
+	}
+
+	if route.Protected {
+		current, status, message := authorize(r.Context(), r.Header.Get("Authorization"), r.Method, r.URL.Path)
+		if status != 0 {
+			writeJSON(w, status, message)
+			return
+		}
+		request.Session = current
+	}
+
+	response, err := route.Handler(r.Context(), request)
+	if err != nil {
+		// API Gateway answers a failed invocation the same way
+		log.Printf("%s %s: %v", r.Method, r.URL.Path, err)
+		writeJSON(w, http.StatusBadGateway, map[string]string{"message": "Internal server error"})
+		return
+	}
+	rest.WriteHTTP(w, response)
+}
+
+// authorize runs the token authorizer and checks the call against the
+// policy it returns. On success it returns the session the authorizer
+// validated; otherwise the status and body API Gateway would answer with.
+func authorize(ctx context.Context, token, method, path string) (*auth.Session, int, map[string]string) {
+	unauthorized := map[string]string{"message": "Invalid or expired token"}
+	if token == "" {
+		return nil, http.StatusUnauthorized, unauthorized
+	}
+
+	methodArn := methodArnPrefix + method + path
+	response, err := authorizer.Handler(ctx, events.APIGatewayCustomAuthorizerRequest{
+		Type:               "TOKEN",
+		AuthorizationToken: token,
+		MethodArn:          methodArn,
+	})
+	if err != nil && err.Error() == "Unauthorized" {
+		return nil, http.StatusUnauthorized, unauthorized
+	}
+	if err != nil {
+		log.Printf("authorizer: %v", err)
+		return nil, http.StatusInternalServerError, map[string]string{"message": "Internal server error"}
+	}
+
+	switch policyEffect(response.PolicyDocument, methodArn) {
+	case "Deny":
+		return nil, http.StatusForbidden, map[string]string{"Message": "User is not authorized to access this resource with an explicit deny"}
+	case "":
+		return nil, http.StatusForbidden, map[string]string{"Message": "User is not authorized to access this resource"}
+	}
+
+	// Read back the way handlers behind API Gateway get it
+	current, valid := auth.SessionFromAuthorizer(response.Context)
+	if !valid {
+		return nil, http.StatusUnauthorized, unauthorized
+	}
+	return current, 0, nil
+}
+
+// policyEffect evaluates a policy the way IAM does: an explicit deny wins,
+// then any allow, and anything else is implicitly denied (returned as "")
+func policyEffect(policy events.APIGatewayCustomAuthorizerPolicy, methodArn string) string {
+	effect := ""
+	for _, statement := range policy.Statement {
+		for _, resource := range statement.Resource {
+			if !arnMatches(resource, methodArn) {
+				continue
+			}
+			if statement.Effect == "Deny" {
+				return "Deny"
+			}
+			effect = statement.Effect
+		}
+	}
+	return effect
+}
+
+// arnMatches matches an ARN against a policy resource, where * stands for
+// any run of characters
+func arnMatches(pattern, arn string) bool {
+	expr := strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*")
+	matched, _ := regexp.MatchString("^"+expr+"$", arn)
+	return matched
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	for name, value := range corsHeaders {
+		w.Header().Set(name, value)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -1,17 +1,84 @@
+// Command server runs the whole API locally. Requests go through the same
+// handlers as the Lambda functions, behind a stand-in for API Gateway and its
+// token authorizer, and the data lives in memory, in a local DynamoDB or in
+// the tables of a deployed stage.
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 
-	"agendum/internal/handlers"
+	"agendum/internal/api"
+	"agendum/internal/api/authn"
+	"agendum/internal/store"
+	"agendum/internal/store/dynamo"
+	"agendum/internal/store/memory"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 )
 
 func main() {
-	http.HandleFunc("/users/create/", handlers.CreateUser)
-	http.HandleFunc("/teams/list/", handlers.ListTeams)
-	
-	fmt.Println("Server starting on :8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
-}
\ No newline at end of file
+	addr := flag.String("addr", ":8080", "address to listen on")
+	storeKind := flag.String("store", "memory", `where to keep data: "memory", "dynamodb-local" or "aws"`)
+	endpoint := flag.String("dynamodb-endpoint", "http://localhost:8000", "DynamoDB endpoint for -store=dynamodb-local")
+	stage := flag.String("stage", "local", "stage whose tables to use with -store=dynamodb-local or -store=aws, such as beta")
+	flag.Parse()
+
+	if err := authn.CheckConfig(); err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := openStore(context.Background(), *storeKind, *endpoint, *stage)
+	if err != nil {
+		log.Fatal(err)
+	}
+	api.SetStore(db)
+
+	log.Printf("Server starting on %s with the %s store", *addr, *storeKind)
+	log.Fatal(http.ListenAndServe(*addr, gateway{}))
+}
+
+func openStore(ctx context.Context, kind, endpoint, stage string) (*store.Store, error) {
+	switch kind {
+	case "memory":
+		return memory.New(), nil
+
+	case "dynamodb-local":
+		// DynamoDB Local accepts any credentials and region
+		region := os.Getenv("AWS_REGION")
+		if region == "" {
+			region = "us-east-1"
+		}
+		cfg, err := config.LoadDefaultConfig(ctx,
+			config.WithRegion(region),
+			config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider("local", "local", "")),
+		)
+		if err != nil {
+			return nil, err
+		}
+		svc := dynamodb.NewFromConfig(cfg, func(o *dynamodb.Options) {
+			o.BaseEndpoint = aws.String(endpoint)
+		})
+		tables := dynamo.TablesForStage(stage)
+		if err := dynamo.CreateTables(ctx, svc, tables); err != nil {
+			return nil, fmt.Errorf("creating tables on %s: %w", endpoint, err)
+		}
+		return dynamo.New(svc, tables), nil
+
+	case "aws":
+		cfg, err := config.LoadDefaultConfig(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return dynamo.New(dynamodb.NewFromConfig(cfg), dynamo.TablesForStage(stage)), nil
+	}
+
+	return nil, fmt.Errorf("unknown store %q, use memory, dynamodb-local or aws", kind)
+}
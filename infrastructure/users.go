@@ -1,10 +1,16 @@
 package main
 
 import (
+	"os"
+
 	"github.com/aws/aws-cdk-go/awscdk/v2"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awsapigateway"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awsdynamodb"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awsevents"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awseventstargets"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awsiam"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awslambda"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awsssm"
 	"github.com/aws/constructs-go/constructs/v10"
 	"github.com/aws/jsii-runtime-go"
 )
@@ -18,6 +24,12 @@ func NewUserStack(scope constructs.Construct, id string, stage string, props *aw
 }
 
 func NewUserInfrastructure(scope constructs.Construct, id string, stage string) {
+	// Reset and verification links are mailed, so where they go has to be a
+	// deliberate choice rather than the log
+	if os.Getenv("MAIL_SENDER") == "" {
+		panic("MAIL_SENDER is required when deploying: ses, or log or file for development stages")
+	}
+
 	// DynamoDB Tables
 	usersTable := awsdynamodb.NewTable(scope, jsii.String(stage+"-Users"), &awsdynamodb.TableProps{
 		TableName: jsii.String(stage + "-Users"),
@@ -28,6 +40,25 @@ func NewUserInfrastructure(scope constructs.Construct, id string, stage string)
 		RemovalPolicy: awscdk.RemovalPolicy_DESTROY,
 	})
 
+	usersTable.AddGlobalSecondaryIndex(&awsdynamodb.GlobalSecondaryIndexProps{
+		IndexName: jsii.String("email-index"),
+		PartitionKey: &awsdynamodb.Attribute{
+			Name: jsii.String("email"),
+			Type: awsdynamodb.AttributeType_STRING,
+		},
+		ProjectionType: awsdynamodb.ProjectionType_ALL,
+	})
+
+	// One item per registered email, used to keep emails unique across users
+	emailsTable := awsdynamodb.NewTable(scope, jsii.String(stage+"-UserEmails"), &awsdynamodb.TableProps{
+		TableName: jsii.String(stage + "-UserEmails"),
+		PartitionKey: &awsdynamodb.Attribute{
+			Name: jsii.String("email"),
+			Type: awsdynamodb.AttributeType_STRING,
+		},
+		RemovalPolicy: awscdk.RemovalPolicy_DESTROY,
+	})
+
 	tasksTable := awsdynamodb.NewTable(scope, jsii.String(stage+"-Tasks"), &awsdynamodb.TableProps{
 		TableName: jsii.String(stage + "-Tasks"),
 		PartitionKey: &awsdynamodb.Attribute{
@@ -37,6 +68,16 @@ func NewUserInfrastructure(scope constructs.Construct, id string, stage string)
 		RemovalPolicy: awscdk.RemovalPolicy_DESTROY,
 	})
 
+	// Lets a user's tasks be reassigned when the user is deleted
+	tasksTable.AddGlobalSecondaryIndex(&awsdynamodb.GlobalSecondaryIndexProps{
+		IndexName: jsii.String("requester-index"),
+		PartitionKey: &awsdynamodb.Attribute{
+			Name: jsii.String("requester"),
+			Type: awsdynamodb.AttributeType_STRING,
+		},
+		ProjectionType: awsdynamodb.ProjectionType_ALL,
+	})
+
 	teamsTable := awsdynamodb.NewTable(scope, jsii.String(stage+"-Teams"), &awsdynamodb.TableProps{
 		TableName: jsii.String(stage + "-Teams"),
 		PartitionKey: &awsdynamodb.Attribute{
@@ -52,80 +93,294 @@ func NewUserInfrastructure(scope constructs.Construct, id string, stage string)
 			Name: jsii.String("token"),
 			Type: awsdynamodb.AttributeType_STRING,
 		},
+		TimeToLiveAttribute: jsii.String("expires_at_epoch"),
 		RemovalPolicy: awscdk.RemovalPolicy_DESTROY,
 	})
 
-	// Lambda Functions
-	createUserLambda := awslambda.NewFunction(scope, jsii.String(stage+"-CreateUserLambda"), &awslambda.FunctionProps{
-		FunctionName: jsii.String(stage + "-CreateUserLambda"),
-		Runtime: awslambda.Runtime_PROVIDED_AL2023(),
-		Handler: jsii.String("bootstrap"),
-		Code:    awslambda.Code_FromAsset(jsii.String("../cmd/lambda-user"), nil),
-		Environment: &map[string]*string{
-			"TABLE_NAME": usersTable.TableName(),
+	sessionsTable.AddGlobalSecondaryIndex(&awsdynamodb.GlobalSecondaryIndexProps{
+		IndexName: jsii.String("username-index"),
+		PartitionKey: &awsdynamodb.Attribute{
+			Name: jsii.String("username"),
+			Type: awsdynamodb.AttributeType_STRING,
 		},
+		ProjectionType: awsdynamodb.ProjectionType_ALL,
 	})
 
-	createTaskLambda := awslambda.NewFunction(scope, jsii.String(stage+"-CreateTaskLambda"), &awslambda.FunctionProps{
-		FunctionName: jsii.String(stage + "-CreateTaskLambda"),
-		Runtime: awslambda.Runtime_PROVIDED_AL2023(),
-		Handler: jsii.String("bootstrap"),
-		Code:    awslambda.Code_FromAsset(jsii.String("../cmd/lambda-task"), nil),
-		Environment: &map[string]*string{
-			"TABLE_NAME": tasksTable.TableName(),
-			"SESSIONS_TABLE_NAME": sessionsTable.TableName(),
-			"TEAMS_TABLE_NAME": teamsTable.TableName(),
+	refreshTokensTable := awsdynamodb.NewTable(scope, jsii.String(stage+"-RefreshTokens"), &awsdynamodb.TableProps{
+		TableName: jsii.String(stage + "-RefreshTokens"),
+		PartitionKey: &awsdynamodb.Attribute{
+			Name: jsii.String("token"),
+			Type: awsdynamodb.AttributeType_STRING,
 		},
+		TimeToLiveAttribute: jsii.String("expires_at_epoch"),
+		RemovalPolicy: awscdk.RemovalPolicy_DESTROY,
 	})
 
-	createTeamLambda := awslambda.NewFunction(scope, jsii.String(stage+"-CreateTeamLambda"), &awslambda.FunctionProps{
-		FunctionName: jsii.String(stage + "-CreateTeamLambda"),
-		Runtime: awslambda.Runtime_PROVIDED_AL2023(),
-		Handler: jsii.String("bootstrap"),
-		Code:    awslambda.Code_FromAsset(jsii.String("../cmd/lambda-team"), nil),
-		Environment: &map[string]*string{
-			"TABLE_NAME": teamsTable.TableName(),
-			"USERS_TABLE_NAME": usersTable.TableName(),
-			"SESSIONS_TABLE_NAME": sessionsTable.TableName(),
+	refreshTokensTable.AddGlobalSecondaryIndex(&awsdynamodb.GlobalSecondaryIndexProps{
+		IndexName: jsii.String("username-index"),
+		PartitionKey: &awsdynamodb.Attribute{
+			Name: jsii.String("username"),
+			Type: awsdynamodb.AttributeType_STRING,
+		},
+		ProjectionType: awsdynamodb.ProjectionType_ALL,
+	})
+
+	// Revoked JWT access tokens, sessions and users, checked when JWTs are validated
+	revokedTokensTable := awsdynamodb.NewTable(scope, jsii.String(stage+"-RevokedTokens"), &awsdynamodb.TableProps{
+		TableName: jsii.String(stage + "-RevokedTokens"),
+		PartitionKey: &awsdynamodb.Attribute{
+			Name: jsii.String("key"),
+			Type: awsdynamodb.AttributeType_STRING,
 		},
+		TimeToLiveAttribute: jsii.String("expires_at_epoch"),
+		RemovalPolicy: awscdk.RemovalPolicy_DESTROY,
 	})
 
-	authLambda := awslambda.NewFunction(scope, jsii.String(stage+"-AuthLambda"), &awslambda.FunctionProps{
-		FunctionName: jsii.String(stage + "-AuthLambda"),
+	// Failed login counters and lockouts per account and per source IP
+	loginAttemptsTable := awsdynamodb.NewTable(scope, jsii.String(stage+"-LoginAttempts"), &awsdynamodb.TableProps{
+		TableName: jsii.String(stage + "-LoginAttempts"),
+		PartitionKey: &awsdynamodb.Attribute{
+			Name: jsii.String("key"),
+			Type: awsdynamodb.AttributeType_STRING,
+		},
+		TimeToLiveAttribute: jsii.String("expires_at_epoch"),
+		RemovalPolicy: awscdk.RemovalPolicy_DESTROY,
+	})
+
+	// Personal access tokens for automation, stored by hash
+	accessTokensTable := awsdynamodb.NewTable(scope, jsii.String(stage+"-AccessTokens"), &awsdynamodb.TableProps{
+		TableName: jsii.String(stage + "-AccessTokens"),
+		PartitionKey: &awsdynamodb.Attribute{
+			Name: jsii.String("token"),
+			Type: awsdynamodb.AttributeType_STRING,
+		},
+		TimeToLiveAttribute: jsii.String("expires_at_epoch"),
+		RemovalPolicy: awscdk.RemovalPolicy_DESTROY,
+	})
+
+	accessTokensTable.AddGlobalSecondaryIndex(&awsdynamodb.GlobalSecondaryIndexProps{
+		IndexName: jsii.String("username-index"),
+		PartitionKey: &awsdynamodb.Attribute{
+			Name: jsii.String("username"),
+			Type: awsdynamodb.AttributeType_STRING,
+		},
+		ProjectionType: awsdynamodb.ProjectionType_ALL,
+	})
+
+	// Short-lived single-use tokens, such as two-factor login challenges
+	oneTimeTokensTable := awsdynamodb.NewTable(scope, jsii.String(stage+"-OneTimeTokens"), &awsdynamodb.TableProps{
+		TableName: jsii.String(stage + "-OneTimeTokens"),
+		PartitionKey: &awsdynamodb.Attribute{
+			Name: jsii.String("token"),
+			Type: awsdynamodb.AttributeType_STRING,
+		},
+		TimeToLiveAttribute: jsii.String("expires_at_epoch"),
+		RemovalPolicy: awscdk.RemovalPolicy_DESTROY,
+	})
+
+	// Secrets are kept in SSM SecureString parameters, whose names are set
+	// when deploying, and read by the functions at cold start
+	secretParameters := map[string]awsssm.IStringParameter{}
+	for _, name := range []string{"JWT_SIGNING_KEYS", "VERIFICATION_SIGNING_KEY", "OIDC_CLIENT_SECRET"} {
+		if parameterName := os.Getenv(name + "_PARAMETER"); parameterName != "" {
+			secretParameters[name] = awsssm.StringParameter_FromSecureStringParameterAttributes(scope, jsii.String(stage+"-"+name), &awsssm.SecureStringParameterAttributes{
+				ParameterName: jsii.String(parameterName),
+			})
+		}
+	}
+	grantSecrets := func(function awslambda.Function, names ...string) {
+		for _, name := range names {
+			if parameter, ok := secretParameters[name]; ok {
+				parameter.GrantRead(function)
+			}
+		}
+	}
+
+	// Settings every function that validates access tokens needs. Set
+	// AUTH_TOKEN_MODE=jwt, JWT_SIGNING_KEYS_PARAMETER and JWT_SIGNING_KID when
+	// deploying to issue stateless JWT access tokens.
+	tokenEnvironment := map[string]*string{
+		"AUTH_TOKEN_MODE": jsii.String(os.Getenv("AUTH_TOKEN_MODE")),
+		"JWT_SIGNING_KEYS_PARAMETER": jsii.String(os.Getenv("JWT_SIGNING_KEYS_PARAMETER")),
+		"JWT_SIGNING_KID": jsii.String(os.Getenv("JWT_SIGNING_KID")),
+		"REVOKED_TOKENS_TABLE_NAME": revokedTokensTable.TableName(),
+	}
+
+	// Lambda Functions, built into ../dist by `go run ./cmd/build`. Deploying
+	// with LAMBDA_BUILD=router serves every API route from the single
+	// lambda-router function instead of one function per handler.
+	var router awslambda.Function
+	if os.Getenv("LAMBDA_BUILD") == "router" {
+		router = awslambda.NewFunction(scope, jsii.String(stage+"-ApiLambda"), &awslambda.FunctionProps{
+			FunctionName: jsii.String(stage + "-ApiLambda"),
+			Runtime: awslambda.Runtime_PROVIDED_AL2023(),
+			Handler: jsii.String("bootstrap"),
+			Code:    awslambda.Code_FromAsset(jsii.String("../dist/lambda-router"), nil),
+		})
+	}
+
+	// apiFunction creates the function behind some of the API's routes. With
+	// the router, it returns the router instead, with the environment added
+	// to its own, so every grant and integration below applies to it.
+	apiFunction := func(name string, asset string, environment *map[string]*string) awslambda.Function {
+		if router != nil {
+			for key, value := range *environment {
+				router.AddEnvironment(jsii.String(key), value, nil)
+			}
+			return router
+		}
+		return awslambda.NewFunction(scope, jsii.String(stage+"-"+name), &awslambda.FunctionProps{
+			FunctionName: jsii.String(stage + "-" + name),
+			Runtime: awslambda.Runtime_PROVIDED_AL2023(),
+			Handler: jsii.String("bootstrap"),
+			Code:    awslambda.Code_FromAsset(jsii.String("../dist/"+asset), nil),
+			Environment: environment,
+		})
+	}
+
+	createUserLambda := apiFunction("CreateUserLambda", "lambda-user", withTokenEnvironment(tokenEnvironment, map[string]*string{
+		"USERS_TABLE_NAME": usersTable.TableName(),
+		"EMAILS_TABLE_NAME": emailsTable.TableName(),
+		"TEAMS_TABLE_NAME": teamsTable.TableName(),
+		"TASKS_TABLE_NAME": tasksTable.TableName(),
+		"SESSIONS_TABLE_NAME": sessionsTable.TableName(),
+		"REFRESH_TOKENS_TABLE_NAME": refreshTokensTable.TableName(),
+		"ACCESS_TOKENS_TABLE_NAME": accessTokensTable.TableName(),
+		"VERIFICATION_SIGNING_KEY_PARAMETER": jsii.String(os.Getenv("VERIFICATION_SIGNING_KEY_PARAMETER")),
+		"PASSWORD_MIN_LENGTH": jsii.String(os.Getenv("PASSWORD_MIN_LENGTH")),
+		"PASSWORD_HASH": jsii.String(os.Getenv("PASSWORD_HASH")),
+		"MAIL_SENDER": jsii.String(os.Getenv("MAIL_SENDER")),
+		"MAIL_FROM": jsii.String(os.Getenv("MAIL_FROM")),
+		"APP_BASE_URL": jsii.String(os.Getenv("APP_BASE_URL")),
+	}))
+
+	createTaskLambda := apiFunction("CreateTaskLambda", "lambda-task", &map[string]*string{
+		"TASKS_TABLE_NAME": tasksTable.TableName(),
+		"TEAMS_TABLE_NAME": teamsTable.TableName(),
+	})
+
+	createTeamLambda := apiFunction("CreateTeamLambda", "lambda-team", &map[string]*string{
+		"TEAMS_TABLE_NAME": teamsTable.TableName(),
+		"USERS_TABLE_NAME": usersTable.TableName(),
+	})
+
+	authLambda := apiFunction("AuthLambda", "lambda-auth", withTokenEnvironment(tokenEnvironment, map[string]*string{
+		"USERS_TABLE_NAME": usersTable.TableName(),
+		"TEAMS_TABLE_NAME": teamsTable.TableName(),
+		"SESSIONS_TABLE_NAME": sessionsTable.TableName(),
+		"REFRESH_TOKENS_TABLE_NAME": refreshTokensTable.TableName(),
+		"LOGIN_ATTEMPTS_TABLE_NAME": loginAttemptsTable.TableName(),
+		"ONE_TIME_TOKENS_TABLE_NAME": oneTimeTokensTable.TableName(),
+		"MAIL_SENDER": jsii.String(os.Getenv("MAIL_SENDER")),
+		"MAIL_FROM": jsii.String(os.Getenv("MAIL_FROM")),
+		"APP_BASE_URL": jsii.String(os.Getenv("APP_BASE_URL")),
+		"UNVERIFIED_LOGIN": jsii.String(os.Getenv("UNVERIFIED_LOGIN")),
+		"PASSWORD_MIN_LENGTH": jsii.String(os.Getenv("PASSWORD_MIN_LENGTH")),
+		"PASSWORD_HASH": jsii.String(os.Getenv("PASSWORD_HASH")),
+		// Single sign-on is off unless OIDC_ISSUER, OIDC_CLIENT_ID and
+		// OIDC_REDIRECT_URL are set when deploying
+		"EMAILS_TABLE_NAME": emailsTable.TableName(),
+		"OIDC_ISSUER": jsii.String(os.Getenv("OIDC_ISSUER")),
+		"OIDC_CLIENT_ID": jsii.String(os.Getenv("OIDC_CLIENT_ID")),
+		"OIDC_CLIENT_SECRET_PARAMETER": jsii.String(os.Getenv("OIDC_CLIENT_SECRET_PARAMETER")),
+		"OIDC_REDIRECT_URL": jsii.String(os.Getenv("OIDC_REDIRECT_URL")),
+		"OIDC_JIT_PROVISIONING": jsii.String(os.Getenv("OIDC_JIT_PROVISIONING")),
+		"ACCESS_TOKEN_TTL": jsii.String("1h"),
+		"REFRESH_TOKEN_TTL": jsii.String("720h"),
+	}))
+
+	listTeamsLambda := apiFunction("ListTeamsLambda", "lambda-list-teams", &map[string]*string{
+		"USERS_TABLE_NAME": usersTable.TableName(),
+		"TEAMS_TABLE_NAME": teamsTable.TableName(),
+	})
+
+	teamSettingsLambda := apiFunction("TeamSettingsLambda", "lambda-team-settings", &map[string]*string{
+		"TEAMS_TABLE_NAME": teamsTable.TableName(),
+	})
+
+	// Validates tokens for every protected route; see cmd/lambda-authorizer
+	authorizerLambda := awslambda.NewFunction(scope, jsii.String(stage+"-AuthorizerLambda"), &awslambda.FunctionProps{
+		FunctionName: jsii.String(stage + "-AuthorizerLambda"),
 		Runtime: awslambda.Runtime_PROVIDED_AL2023(),
 		Handler: jsii.String("bootstrap"),
-		Code:    awslambda.Code_FromAsset(jsii.String("../cmd/lambda-auth"), nil),
-		Environment: &map[string]*string{
-			"USERS_TABLE_NAME": usersTable.TableName(),
+		Code:    awslambda.Code_FromAsset(jsii.String("../dist/lambda-authorizer"), nil),
+		Environment: withTokenEnvironment(tokenEnvironment, map[string]*string{
 			"SESSIONS_TABLE_NAME": sessionsTable.TableName(),
-		},
+			"ACCESS_TOKENS_TABLE_NAME": accessTokensTable.TableName(),
+			"USERS_TABLE_NAME": usersTable.TableName(),
+		}),
+	})
+
+	// Personal access tokens and service accounts; see cmd/lambda-tokens
+	tokensLambda := apiFunction("TokensLambda", "lambda-tokens", &map[string]*string{
+		"ACCESS_TOKENS_TABLE_NAME": accessTokensTable.TableName(),
+		"USERS_TABLE_NAME": usersTable.TableName(),
+		"TEAMS_TABLE_NAME": teamsTable.TableName(),
 	})
 
-	listTeamsLambda := awslambda.NewFunction(scope, jsii.String(stage+"-ListTeamsLambda"), &awslambda.FunctionProps{
-		FunctionName: jsii.String(stage + "-ListTeamsLambda"),
+	sessionSweeperLambda := awslambda.NewFunction(scope, jsii.String(stage+"-SessionSweeperLambda"), &awslambda.FunctionProps{
+		FunctionName: jsii.String(stage + "-SessionSweeperLambda"),
 		Runtime: awslambda.Runtime_PROVIDED_AL2023(),
 		Handler: jsii.String("bootstrap"),
-		Code:    awslambda.Code_FromAsset(jsii.String("../cmd/lambda-list-teams"), nil),
+		Code:    awslambda.Code_FromAsset(jsii.String("../dist/lambda-session-sweeper"), nil),
+		Timeout: awscdk.Duration_Minutes(jsii.Number(5)),
 		Environment: &map[string]*string{
-			"USERS_TABLE_NAME": usersTable.TableName(),
-			"TEAMS_TABLE_NAME": teamsTable.TableName(),
 			"SESSIONS_TABLE_NAME": sessionsTable.TableName(),
 		},
 	})
 
+	// Sessions written before expires_at_epoch existed are never removed by TTL
+	awsevents.NewRule(scope, jsii.String(stage+"-SessionSweeperSchedule"), &awsevents.RuleProps{
+		Schedule: awsevents.Schedule_Rate(awscdk.Duration_Hours(jsii.Number(1))),
+		Targets: &[]awsevents.IRuleTarget{
+			awseventstargets.NewLambdaFunction(sessionSweeperLambda, nil),
+		},
+	})
+
 	// Grant permissions
-	usersTable.GrantWriteData(createUserLambda)
-	usersTable.GrantReadData(authLambda)
+	grantSecrets(createUserLambda, "JWT_SIGNING_KEYS", "VERIFICATION_SIGNING_KEY")
+	grantSecrets(authLambda, "JWT_SIGNING_KEYS", "OIDC_CLIENT_SECRET")
+	grantSecrets(authorizerLambda, "JWT_SIGNING_KEYS")
+
+	usersTable.GrantReadWriteData(createUserLambda)
+	emailsTable.GrantReadWriteData(createUserLambda)
+	usersTable.GrantReadWriteData(authLambda)
+	emailsTable.GrantWriteData(authLambda)
 	usersTable.GrantReadData(listTeamsLambda)
 	usersTable.GrantWriteData(createTeamLambda)
 	tasksTable.GrantWriteData(createTaskLambda)
+	tasksTable.GrantReadWriteData(createUserLambda)
 	teamsTable.GrantWriteData(createTeamLambda)
 	teamsTable.GrantReadData(createTaskLambda)
 	teamsTable.GrantReadData(listTeamsLambda)
-	sessionsTable.GrantWriteData(authLambda)
-	sessionsTable.GrantReadData(createTaskLambda)
-	sessionsTable.GrantReadData(createTeamLambda)
-	sessionsTable.GrantReadData(listTeamsLambda)
+	teamsTable.GrantReadData(authLambda)
+	teamsTable.GrantReadWriteData(teamSettingsLambda)
+	teamsTable.GrantReadWriteData(createUserLambda)
+	sessionsTable.GrantReadWriteData(authLambda)
+	sessionsTable.GrantReadData(authorizerLambda)
+	usersTable.GrantReadData(authorizerLambda)
+	sessionsTable.GrantReadWriteData(createUserLambda)
+	sessionsTable.GrantReadWriteData(sessionSweeperLambda)
+	refreshTokensTable.GrantReadWriteData(authLambda)
+	refreshTokensTable.GrantReadWriteData(createUserLambda)
+	revokedTokensTable.GrantReadWriteData(authLambda)
+	revokedTokensTable.GrantReadWriteData(createUserLambda)
+	revokedTokensTable.GrantReadData(authorizerLambda)
+	loginAttemptsTable.GrantReadWriteData(authLambda)
+	oneTimeTokensTable.GrantReadWriteData(authLambda)
+	accessTokensTable.GrantReadWriteData(authorizerLambda)
+	accessTokensTable.GrantReadWriteData(createUserLambda)
+	accessTokensTable.GrantReadWriteData(tokensLambda)
+	usersTable.GrantReadWriteData(tokensLambda)
+	teamsTable.GrantReadWriteData(tokensLambda)
+
+	// Password reset and verification emails when deployed with MAIL_SENDER=ses
+	sendEmail := awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+		Actions:   jsii.Strings("ses:SendEmail"),
+		Resources: jsii.Strings("*"),
+	})
+	authLambda.AddToRolePolicy(sendEmail)
+	createUserLambda.AddToRolePolicy(sendEmail)
 
 	// API Gateway
 	api := awsapigateway.NewRestApi(scope, jsii.String(stage+"-AgendumApi"), &awsapigateway.RestApiProps{
@@ -145,6 +400,28 @@ func NewUserInfrastructure(scope constructs.Construct, id string, stage string)
 		},
 	}
 
+	// Protected routes go through the authorizer, which API Gateway caches per
+	// token for a minute, so revoked tokens can keep working for that long
+	authorizer := awsapigateway.NewTokenAuthorizer(scope, jsii.String(stage+"-TokenAuthorizer"), &awsapigateway.TokenAuthorizerProps{
+		Handler:         authorizerLambda,
+		ResultsCacheTtl: awscdk.Duration_Minutes(jsii.Number(1)),
+	})
+	protected := &awsapigateway.MethodOptions{
+		AuthorizationType: awsapigateway.AuthorizationType_CUSTOM,
+		Authorizer:        authorizer,
+	}
+
+	// Return CORS headers on authorizer rejections so browsers can read them
+	api.AddGatewayResponse(jsii.String(stage+"-UnauthorizedResponse"), &awsapigateway.GatewayResponseOptions{
+		Type: awsapigateway.ResponseType_UNAUTHORIZED(),
+		ResponseHeaders: &map[string]*string{
+			"Access-Control-Allow-Origin": jsii.String("'*'"),
+		},
+		Templates: &map[string]*string{
+			"application/json": jsii.String(`{"message":"Invalid or expired token"}`),
+		},
+	})
+
 	// Users endpoints
 	users := api.Root().AddResource(jsii.String("users"), &awsapigateway.ResourceOptions{
 		DefaultCorsPreflightOptions: corsOptions,
@@ -154,6 +431,33 @@ func NewUserInfrastructure(scope constructs.Construct, id string, stage string)
 	})
 	usersCreate.AddMethod(jsii.String("POST"), awsapigateway.NewLambdaIntegration(createUserLambda, nil), nil)
 
+	usersMe := users.AddResource(jsii.String("me"), &awsapigateway.ResourceOptions{
+		DefaultCorsPreflightOptions: corsOptions,
+	})
+	usersMe.AddMethod(jsii.String("GET"), awsapigateway.NewLambdaIntegration(createUserLambda, nil), protected)
+	usersMe.AddMethod(jsii.String("PATCH"), awsapigateway.NewLambdaIntegration(createUserLambda, nil), protected)
+	usersMe.AddMethod(jsii.String("DELETE"), awsapigateway.NewLambdaIntegration(createUserLambda, nil), protected)
+
+	usersVerify := users.AddResource(jsii.String("verify"), &awsapigateway.ResourceOptions{
+		DefaultCorsPreflightOptions: corsOptions,
+	})
+	usersVerify.AddMethod(jsii.String("POST"), awsapigateway.NewLambdaIntegration(createUserLambda, nil), nil)
+
+	usersVerifyResend := usersVerify.AddResource(jsii.String("resend"), &awsapigateway.ResourceOptions{
+		DefaultCorsPreflightOptions: corsOptions,
+	})
+	usersVerifyResend.AddMethod(jsii.String("POST"), awsapigateway.NewLambdaIntegration(createUserLambda, nil), nil)
+
+	user := users.AddResource(jsii.String("{username}"), &awsapigateway.ResourceOptions{
+		DefaultCorsPreflightOptions: corsOptions,
+	})
+	user.AddMethod(jsii.String("GET"), awsapigateway.NewLambdaIntegration(createUserLambda, nil), protected)
+
+	userType := user.AddResource(jsii.String("type"), &awsapigateway.ResourceOptions{
+		DefaultCorsPreflightOptions: corsOptions,
+	})
+	userType.AddMethod(jsii.String("PUT"), awsapigateway.NewLambdaIntegration(createUserLambda, nil), protected)
+
 	// Tasks endpoints
 	tasks := api.Root().AddResource(jsii.String("tasks"), &awsapigateway.ResourceOptions{
 		DefaultCorsPreflightOptions: corsOptions,
@@ -161,7 +465,7 @@ func NewUserInfrastructure(scope constructs.Construct, id string, stage string)
 	tasksCreate := tasks.AddResource(jsii.String("create"), &awsapigateway.ResourceOptions{
 		DefaultCorsPreflightOptions: corsOptions,
 	})
-	tasksCreate.AddMethod(jsii.String("POST"), awsapigateway.NewLambdaIntegration(createTaskLambda, nil), nil)
+	tasksCreate.AddMethod(jsii.String("POST"), awsapigateway.NewLambdaIntegration(createTaskLambda, nil), protected)
 
 	// Teams endpoints
 	teams := api.Root().AddResource(jsii.String("teams"), &awsapigateway.ResourceOptions{
@@ -170,12 +474,38 @@ func NewUserInfrastructure(scope constructs.Construct, id string, stage string)
 	teamsCreate := teams.AddResource(jsii.String("create"), &awsapigateway.ResourceOptions{
 		DefaultCorsPreflightOptions: corsOptions,
 	})
-	teamsCreate.AddMethod(jsii.String("POST"), awsapigateway.NewLambdaIntegration(createTeamLambda, nil), nil)
+	teamsCreate.AddMethod(jsii.String("POST"), awsapigateway.NewLambdaIntegration(createTeamLambda, nil), protected)
 
 	teamsList := teams.AddResource(jsii.String("list"), &awsapigateway.ResourceOptions{
 		DefaultCorsPreflightOptions: corsOptions,
 	})
-	teamsList.AddMethod(jsii.String("GET"), awsapigateway.NewLambdaIntegration(listTeamsLambda, nil), nil)
+	teamsList.AddMethod(jsii.String("GET"), awsapigateway.NewLambdaIntegration(listTeamsLambda, nil), protected)
+
+	team := teams.AddResource(jsii.String("{team_id}"), &awsapigateway.ResourceOptions{
+		DefaultCorsPreflightOptions: corsOptions,
+	})
+	teamSettings := team.AddResource(jsii.String("settings"), &awsapigateway.ResourceOptions{
+		DefaultCorsPreflightOptions: corsOptions,
+	})
+	teamSettings.AddMethod(jsii.String("GET"), awsapigateway.NewLambdaIntegration(teamSettingsLambda, nil), protected)
+	teamSettings.AddMethod(jsii.String("PUT"), awsapigateway.NewLambdaIntegration(teamSettingsLambda, nil), protected)
+
+	serviceAccounts := team.AddResource(jsii.String("service-accounts"), &awsapigateway.ResourceOptions{
+		DefaultCorsPreflightOptions: corsOptions,
+	})
+	serviceAccounts.AddMethod(jsii.String("POST"), awsapigateway.NewLambdaIntegration(tokensLambda, nil), protected)
+
+	// Personal access token endpoints
+	tokens := api.Root().AddResource(jsii.String("tokens"), &awsapigateway.ResourceOptions{
+		DefaultCorsPreflightOptions: corsOptions,
+	})
+	tokens.AddMethod(jsii.String("POST"), awsapigateway.NewLambdaIntegration(tokensLambda, nil), protected)
+	tokens.AddMethod(jsii.String("GET"), awsapigateway.NewLambdaIntegration(tokensLambda, nil), protected)
+
+	tokenByID := tokens.AddResource(jsii.String("{token_id}"), &awsapigateway.ResourceOptions{
+		DefaultCorsPreflightOptions: corsOptions,
+	})
+	tokenByID.AddMethod(jsii.String("DELETE"), awsapigateway.NewLambdaIntegration(tokensLambda, nil), protected)
 
 	// Auth endpoints
 	auth := api.Root().AddResource(jsii.String("auth"), &awsapigateway.ResourceOptions{
@@ -185,4 +515,94 @@ func NewUserInfrastructure(scope constructs.Construct, id string, stage string)
 		DefaultCorsPreflightOptions: corsOptions,
 	})
 	login.AddMethod(jsii.String("POST"), awsapigateway.NewLambdaIntegration(authLambda, nil), nil)
-}
\ No newline at end of file
+
+	refresh := auth.AddResource(jsii.String("refresh"), &awsapigateway.ResourceOptions{
+		DefaultCorsPreflightOptions: corsOptions,
+	})
+	refresh.AddMethod(jsii.String("POST"), awsapigateway.NewLambdaIntegration(authLambda, nil), nil)
+
+	logout := auth.AddResource(jsii.String("logout"), &awsapigateway.ResourceOptions{
+		DefaultCorsPreflightOptions: corsOptions,
+	})
+	logout.AddMethod(jsii.String("POST"), awsapigateway.NewLambdaIntegration(authLambda, nil), protected)
+
+	sessions := auth.AddResource(jsii.String("sessions"), &awsapigateway.ResourceOptions{
+		DefaultCorsPreflightOptions: corsOptions,
+	})
+	sessions.AddMethod(jsii.String("GET"), awsapigateway.NewLambdaIntegration(authLambda, nil), protected)
+	sessions.AddMethod(jsii.String("DELETE"), awsapigateway.NewLambdaIntegration(authLambda, nil), protected)
+
+	sessionByID := sessions.AddResource(jsii.String("{id}"), &awsapigateway.ResourceOptions{
+		DefaultCorsPreflightOptions: corsOptions,
+	})
+	sessionByID.AddMethod(jsii.String("DELETE"), awsapigateway.NewLambdaIntegration(authLambda, nil), protected)
+
+	unlock := auth.AddResource(jsii.String("unlock"), &awsapigateway.ResourceOptions{
+		DefaultCorsPreflightOptions: corsOptions,
+	})
+	unlock.AddMethod(jsii.String("POST"), awsapigateway.NewLambdaIntegration(authLambda, nil), protected)
+
+	mfa := auth.AddResource(jsii.String("mfa"), &awsapigateway.ResourceOptions{
+		DefaultCorsPreflightOptions: corsOptions,
+	})
+
+	mfaEnroll := mfa.AddResource(jsii.String("enroll"), &awsapigateway.ResourceOptions{
+		DefaultCorsPreflightOptions: corsOptions,
+	})
+	mfaEnroll.AddMethod(jsii.String("POST"), awsapigateway.NewLambdaIntegration(authLambda, nil), protected)
+
+	mfaConfirm := mfa.AddResource(jsii.String("confirm"), &awsapigateway.ResourceOptions{
+		DefaultCorsPreflightOptions: corsOptions,
+	})
+	mfaConfirm.AddMethod(jsii.String("POST"), awsapigateway.NewLambdaIntegration(authLambda, nil), protected)
+
+	mfaVerify := mfa.AddResource(jsii.String("verify"), &awsapigateway.ResourceOptions{
+		DefaultCorsPreflightOptions: corsOptions,
+	})
+	mfaVerify.AddMethod(jsii.String("POST"), awsapigateway.NewLambdaIntegration(authLambda, nil), nil)
+
+	password := auth.AddResource(jsii.String("password"), &awsapigateway.ResourceOptions{
+		DefaultCorsPreflightOptions: corsOptions,
+	})
+
+	passwordChange := password.AddResource(jsii.String("change"), &awsapigateway.ResourceOptions{
+		DefaultCorsPreflightOptions: corsOptions,
+	})
+	passwordChange.AddMethod(jsii.String("POST"), awsapigateway.NewLambdaIntegration(authLambda, nil), protected)
+
+	passwordForgot := password.AddResource(jsii.String("forgot"), &awsapigateway.ResourceOptions{
+		DefaultCorsPreflightOptions: corsOptions,
+	})
+	passwordForgot.AddMethod(jsii.String("POST"), awsapigateway.NewLambdaIntegration(authLambda, nil), nil)
+
+	passwordReset := password.AddResource(jsii.String("reset"), &awsapigateway.ResourceOptions{
+		DefaultCorsPreflightOptions: corsOptions,
+	})
+	passwordReset.AddMethod(jsii.String("POST"), awsapigateway.NewLambdaIntegration(authLambda, nil), nil)
+
+	oidc := auth.AddResource(jsii.String("oidc"), &awsapigateway.ResourceOptions{
+		DefaultCorsPreflightOptions: corsOptions,
+	})
+
+	oidcLogin := oidc.AddResource(jsii.String("login"), &awsapigateway.ResourceOptions{
+		DefaultCorsPreflightOptions: corsOptions,
+	})
+	oidcLogin.AddMethod(jsii.String("GET"), awsapigateway.NewLambdaIntegration(authLambda, nil), nil)
+
+	oidcCallback := oidc.AddResource(jsii.String("callback"), &awsapigateway.ResourceOptions{
+		DefaultCorsPreflightOptions: corsOptions,
+	})
+	oidcCallback.AddMethod(jsii.String("POST"), awsapigateway.NewLambdaIntegration(authLambda, nil), nil)
+}
+
+// withTokenEnvironment adds the shared token settings to a function's environment
+func withTokenEnvironment(tokenEnvironment map[string]*string, environment map[string]*string) *map[string]*string {
+	merged := make(map[string]*string)
+	for name, value := range tokenEnvironment {
+		merged[name] = value
+	}
+	for name, value := range environment {
+		merged[name] = value
+	}
+	return &merged
+}
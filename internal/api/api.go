@@ -0,0 +1,147 @@
+// Package api lists every route of the HTTP API with the handler behind it,
+// mirroring the API Gateway resources defined in infrastructure/. The
+// handlers themselves live in one subpackage per Lambda function.
+package api
+
+import (
+	"context"
+	"strings"
+
+	"agendum/internal/api/authn"
+	"agendum/internal/api/authorizer"
+	"agendum/internal/api/listteams"
+	"agendum/internal/api/rest"
+	"agendum/internal/api/task"
+	"agendum/internal/api/team"
+	"agendum/internal/api/teamsettings"
+	"agendum/internal/api/tokens"
+	"agendum/internal/api/user"
+	"agendum/internal/store"
+)
+
+// Route is one method of an API Gateway resource
+type Route struct {
+	Method string
+	// Resource is the API Gateway resource path, with path parameters in
+	// braces such as /users/{username}
+	Resource string
+	// Protected routes go through the authorizer before the handler
+	Protected bool
+	Handler   rest.HandlerFunc
+}
+
+// Routes is every route of the API
+var Routes = []Route{
+	{"POST", "/users/create", false, user.Handler},
+	{"GET", "/users/me", true, user.Handler},
+	{"PATCH", "/users/me", true, user.Handler},
+	{"DELETE", "/users/me", true, user.Handler},
+	{"POST", "/users/verify", false, user.Handler},
+	{"POST", "/users/verify/resend", false, user.Handler},
+	{"GET", "/users/{username}", true, user.Handler},
+	{"PUT", "/users/{username}/type", true, user.Handler},
+
+	{"POST", "/tasks/create", true, task.Handler},
+
+	{"POST", "/teams/create", true, team.Handler},
+	{"GET", "/teams/list", true, listteams.Handler},
+	{"GET", "/teams/{team_id}/settings", true, teamsettings.Handler},
+	{"PUT", "/teams/{team_id}/settings", true, teamsettings.Handler},
+	{"POST", "/teams/{team_id}/service-accounts", true, tokens.Handler},
+
+	{"POST", "/tokens", true, tokens.Handler},
+	{"GET", "/tokens", true, tokens.Handler},
+	{"DELETE", "/tokens/{token_id}", true, tokens.Handler},
+
+	{"POST", "/auth/login", false, authn.Handler},
+	{"POST", "/auth/refresh", false, authn.Handler},
+	{"POST", "/auth/logout", true, authn.Handler},
+	{"GET", "/auth/sessions", true, authn.Handler},
+	{"DELETE", "/auth/sessions", true, authn.Handler},
+	{"DELETE", "/auth/sessions/{id}", true, authn.Handler},
+	{"POST", "/auth/unlock", true, authn.Handler},
+	{"POST", "/auth/mfa/enroll", true, authn.Handler},
+	{"POST", "/auth/mfa/confirm", true, authn.Handler},
+	{"POST", "/auth/mfa/verify", false, authn.Handler},
+	{"POST", "/auth/password/change", true, authn.Handler},
+	{"POST", "/auth/password/forgot", false, authn.Handler},
+	{"POST", "/auth/password/reset", false, authn.Handler},
+	{"GET", "/auth/oidc/login", false, authn.Handler},
+	{"POST", "/auth/oidc/callback", false, authn.Handler},
+}
+
+// SetStore points every handler, and the authorizer, at the same store
+func SetStore(s *store.Store) {
+	authn.SetStore(s)
+	authorizer.SetStore(s)
+	listteams.SetStore(s)
+	task.SetStore(s)
+	team.SetStore(s)
+	teamsettings.SetStore(s)
+	tokens.SetStore(s)
+	user.SetStore(s)
+}
+
+// Handle calls the handler of the request's route, found by its method and
+// resource, so a single Lambda function can serve every route of the API
+func Handle(ctx context.Context, request rest.Request) (rest.Response, error) {
+	for _, route := range Routes {
+		if route.Method == request.Method && route.Resource == request.Resource {
+			return route.Handler(ctx, request)
+		}
+	}
+	return rest.Response{
+		StatusCode: 404,
+		Headers: map[string]string{
+			"Content-Type":                "application/json",
+			"Access-Control-Allow-Origin": "*",
+		},
+		Body: `{"message":"Not found"}`,
+	}, nil
+}
+
+// Match finds the resource a concrete path belongs to, along with the values
+// of its path parameters. Like API Gateway, literal segments win over path
+// parameters, so /users/me isn't taken for /users/{username}. It returns the
+// resource's routes for every method, which are empty when nothing matches.
+func Match(path string) (string, map[string]string, []Route) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+
+	var best string
+	var bestParams map[string]string
+	for _, route := range Routes {
+		params, ok := matchResource(route.Resource, segments)
+		if !ok || (best != "" && len(params) >= len(bestParams)) {
+			continue
+		}
+		best, bestParams = route.Resource, params
+	}
+
+	var routes []Route
+	for _, route := range Routes {
+		if best != "" && route.Resource == best {
+			routes = append(routes, route)
+		}
+	}
+	return best, bestParams, routes
+}
+
+func matchResource(resource string, segments []string) (map[string]string, bool) {
+	parts := strings.Split(strings.Trim(resource, "/"), "/")
+	if len(parts) != len(segments) {
+		return nil, false
+	}
+
+	params := make(map[string]string)
+	for i, part := range parts {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			if segments[i] == "" {
+				return nil, false
+			}
+			params[strings.Trim(part, "{}")] = segments[i]
+		} else if part != segments[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
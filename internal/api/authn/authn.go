@@ -0,0 +1,82 @@
+// Package authn serves the /auth routes: logins, token refresh, sessions,
+// two-factor authentication, passwords and single sign-on.
+package authn
+
+import (
+	"context"
+	"encoding/json"
+
+	"agendum/internal/api/rest"
+	"agendum/internal/store"
+)
+
+var db *store.Store
+
+// SetStore sets the store the handlers read and write
+func SetStore(s *store.Store) {
+	db = s
+}
+
+func response(statusCode int, body string) rest.Response {
+	return rest.Response{
+		StatusCode: statusCode,
+		Headers: map[string]string{
+			"Content-Type":                 "application/json",
+			"Access-Control-Allow-Origin":  "*",
+			"Access-Control-Allow-Headers": "Content-Type,X-Amz-Date,Authorization,X-Api-Key,X-Amz-Security-Token",
+			"Access-Control-Allow-Methods": "GET,POST,DELETE,OPTIONS",
+		},
+		Body: body,
+	}
+}
+
+func errorResponse(statusCode int, message string) rest.Response {
+	body, _ := json.Marshal(map[string]string{"message": message})
+	return response(statusCode, string(body))
+}
+
+// Handler serves every /auth route
+func Handler(ctx context.Context, request rest.Request) (rest.Response, error) {
+	switch request.Resource {
+	case "/auth/login":
+		return login(ctx, request)
+	case "/auth/refresh":
+		return refresh(ctx, request)
+	case "/auth/mfa/verify":
+		return mfaVerify(ctx, request)
+	case "/auth/password/forgot":
+		return forgotPassword(ctx, request.Body)
+	case "/auth/password/reset":
+		return resetPassword(ctx, request.Body)
+	case "/auth/oidc/login":
+		return oidcLogin(ctx)
+	case "/auth/oidc/callback":
+		return oidcCallback(ctx, request)
+	}
+
+	current, valid := request.Authenticated()
+	if !valid {
+		return errorResponse(401, "Invalid or expired token"), nil
+	}
+
+	switch request.Method + " " + request.Resource {
+	case "POST /auth/logout":
+		return logout(ctx, current)
+	case "GET /auth/sessions":
+		return listSessions(ctx, current)
+	case "DELETE /auth/sessions":
+		return revokeAllSessions(ctx, current)
+	case "DELETE /auth/sessions/{id}":
+		return revokeSession(ctx, current, request.PathParams["id"])
+	case "POST /auth/unlock":
+		return unlock(ctx, current.Username, request.Body)
+	case "POST /auth/mfa/enroll":
+		return mfaEnroll(ctx, current.Username)
+	case "POST /auth/mfa/confirm":
+		return mfaConfirm(ctx, current.Username, request.Body)
+	case "POST /auth/password/change":
+		return changePassword(ctx, current, request.Body)
+	}
+
+	return errorResponse(404, "Not found"), nil
+}
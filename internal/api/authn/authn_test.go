@@ -0,0 +1,287 @@
+package authn
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"agendum/internal/api/rest"
+	"agendum/internal/store"
+	"agendum/internal/store/memory"
+	"agendum/pkg/auth"
+	"agendum/pkg/password"
+)
+
+const testPassword = "correct-horse-battery"
+
+// setup points the handlers at an empty memory store holding one verified
+// user, alice@example.com
+func setup(t *testing.T) *store.Store {
+	t.Helper()
+	s := memory.New()
+	SetStore(s)
+
+	hash, err := password.Hash(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Users.Create(context.Background(), &store.User{
+		Username:      "alice",
+		Email:         "alice@example.com",
+		Password:      hash,
+		UserType:      auth.UserTypeStandard,
+		TeamIDs:       []string{},
+		EmailVerified: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func call(t *testing.T, resource string, body interface{}) (rest.Response, map[string]interface{}) {
+	t.Helper()
+	encoded, _ := json.Marshal(body)
+	resp, err := Handler(context.Background(), rest.Request{
+		Method:   "POST",
+		Resource: resource,
+		Body:     string(encoded),
+		SourceIP: "192.0.2.1",
+	})
+	if err != nil {
+		t.Fatalf("%s: %v", resource, err)
+	}
+	decoded := map[string]interface{}{}
+	json.Unmarshal([]byte(resp.Body), &decoded)
+	return resp, decoded
+}
+
+func loginAs(t *testing.T, pass string) (rest.Response, map[string]interface{}) {
+	t.Helper()
+	return call(t, "/auth/login", LoginRequest{Email: "Alice@Example.com ", Password: pass})
+}
+
+func TestLogin(t *testing.T) {
+	db := setup(t)
+
+	resp, body := loginAs(t, testPassword)
+	if resp.StatusCode != 200 {
+		t.Fatalf("login: got %d %s", resp.StatusCode, resp.Body)
+	}
+	token, _ := body["token"].(string)
+	if token == "" || body["refresh_token"] == "" {
+		t.Fatalf("login: no tokens in %s", resp.Body)
+	}
+
+	current, valid := auth.GetSession(context.Background(), db, token)
+	if !valid || current.Username != "alice" {
+		t.Fatalf("access token doesn't resolve to alice's session: %+v", current)
+	}
+	// The stored key is the hash, which mustn't work as a token itself
+	if _, valid := auth.GetSession(context.Background(), db, current.Token); valid || current.Token == token {
+		t.Error("stored session key is usable as a token")
+	}
+
+	resp, _ = loginAs(t, "wrong-password-1")
+	if resp.StatusCode != 401 {
+		t.Errorf("wrong password: got %d, want 401", resp.StatusCode)
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	setup(t)
+
+	for i := 0; i < accountFreeFailures; i++ {
+		if resp, _ := loginAs(t, "wrong-password-1"); resp.StatusCode != 401 {
+			t.Fatalf("failure %d: got %d, want 401", i+1, resp.StatusCode)
+		}
+	}
+	// Still within the free attempts
+	if resp, _ := loginAs(t, testPassword); resp.StatusCode != 200 {
+		t.Fatalf("login after %d failures: got %d, want 200", accountFreeFailures, resp.StatusCode)
+	}
+
+	// The successful login reset the counter
+	for i := 0; i <= accountFreeFailures; i++ {
+		loginAs(t, "wrong-password-1")
+	}
+	resp, _ := loginAs(t, testPassword)
+	if resp.StatusCode != 429 {
+		t.Fatalf("login after %d failures: got %d, want 429", accountFreeFailures+1, resp.StatusCode)
+	}
+	if resp.Headers["Retry-After"] == "" {
+		t.Error("locked response has no Retry-After")
+	}
+}
+
+func TestMFAFailuresLockAccount(t *testing.T) {
+	db := setup(t)
+	ctx := context.Background()
+	secret, codes := auth.GenerateTOTPSecret(), auth.GenerateRecoveryCodes(2)
+	if err := db.Users.SetMFAPendingSecret(ctx, "alice", secret); err != nil {
+		t.Fatal(err)
+	}
+	err := db.Users.EnableMFA(ctx, "alice", secret, []string{auth.HashToken(codes[0]), auth.HashToken(codes[1])}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	challenge := func() string {
+		t.Helper()
+		resp, body := loginAs(t, testPassword)
+		if resp.StatusCode != 200 || body["mfa_required"] != true {
+			t.Fatalf("login: got %d %s, want an MFA challenge", resp.StatusCode, resp.Body)
+		}
+		return body["mfa_token"].(string)
+	}
+
+	// A recovery code sent with a bad challenge isn't used up
+	resp, _ := call(t, "/auth/mfa/verify", MFAVerifyRequest{MFAToken: "no-such-challenge", RecoveryCode: codes[0]})
+	if resp.StatusCode != 401 {
+		t.Fatalf("verify with a bad challenge: got %d, want 401", resp.StatusCode)
+	}
+	resp, _ = call(t, "/auth/mfa/verify", MFAVerifyRequest{MFAToken: challenge(), RecoveryCode: codes[0]})
+	if resp.StatusCode != 200 {
+		t.Fatalf("verify with a recovery code: got %d %s, want 200", resp.StatusCode, resp.Body)
+	}
+	resp, _ = call(t, "/auth/mfa/verify", MFAVerifyRequest{MFAToken: challenge(), RecoveryCode: codes[0]})
+	if resp.StatusCode != 401 {
+		t.Fatalf("reusing a recovery code: got %d, want 401", resp.StatusCode)
+	}
+
+	// Wrong codes count against the account even across challenges, which
+	// a correct password no longer resets
+	for i := 0; i < accountFreeFailures; i++ {
+		resp, _ := call(t, "/auth/mfa/verify", MFAVerifyRequest{MFAToken: challenge(), RecoveryCode: "wrong-code"})
+		if resp.StatusCode != 401 {
+			t.Fatalf("wrong code %d: got %d, want 401", i+1, resp.StatusCode)
+		}
+	}
+	resp, _ = loginAs(t, testPassword)
+	if resp.StatusCode != 429 {
+		t.Fatalf("login after wrong codes: got %d, want 429", resp.StatusCode)
+	}
+}
+
+func TestRefreshReuse(t *testing.T) {
+	db := setup(t)
+	ctx := context.Background()
+
+	_, body := loginAs(t, testPassword)
+	first := body["refresh_token"].(string)
+
+	resp, body := call(t, "/auth/refresh", RefreshRequest{RefreshToken: first})
+	if resp.StatusCode != 200 {
+		t.Fatalf("refresh: got %d %s", resp.StatusCode, resp.Body)
+	}
+	second, access := body["refresh_token"].(string), body["token"].(string)
+	if second == first {
+		t.Fatal("refresh token wasn't rotated")
+	}
+	if _, valid := auth.GetSession(ctx, db, access); !valid {
+		t.Fatal("refreshed access token is invalid")
+	}
+
+	// Presenting the first token again means it leaked: the whole session,
+	// including the tokens it was exchanged for, is revoked
+	resp, _ = call(t, "/auth/refresh", RefreshRequest{RefreshToken: first})
+	if resp.StatusCode != 401 || !strings.Contains(resp.Body, "already used") {
+		t.Fatalf("reused refresh token: got %d %s, want 401", resp.StatusCode, resp.Body)
+	}
+	if resp, _ := call(t, "/auth/refresh", RefreshRequest{RefreshToken: second}); resp.StatusCode != 401 {
+		t.Errorf("rotated refresh token after reuse: got %d, want 401", resp.StatusCode)
+	}
+	if _, valid := auth.GetSession(ctx, db, access); valid {
+		t.Error("access token still valid after reuse")
+	}
+}
+
+func TestForgotPasswordRateLimited(t *testing.T) {
+	setup(t)
+	dir := t.TempDir()
+	t.Setenv("MAIL_SENDER", "file")
+	t.Setenv("MAIL_DIR", dir)
+
+	// Known and unknown emails, sent or rate limited, all get the same answer
+	for _, email := range []string{"alice@example.com", "alice@example.com", "nobody@example.com"} {
+		resp, _ := call(t, "/auth/password/forgot", ForgotPasswordRequest{Email: email})
+		if resp.StatusCode != 202 {
+			t.Fatalf("forgot password for %s: got %d %s, want 202", email, resp.StatusCode, resp.Body)
+		}
+	}
+
+	sent, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sent) != 1 {
+		t.Errorf("sent %d reset emails, want 1", len(sent))
+	}
+}
+
+func TestChangePasswordLockout(t *testing.T) {
+	setup(t)
+	change := func(current string) rest.Response {
+		t.Helper()
+		body, _ := json.Marshal(ChangePasswordRequest{CurrentPassword: current, NewPassword: "another-horse-battery"})
+		resp, err := Handler(context.Background(), rest.Request{
+			Method:   "POST",
+			Resource: "/auth/password/change",
+			Body:     string(body),
+			Session:  &auth.Session{Username: "alice", SessionID: "session-1"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	for i := 0; i <= accountFreeFailures; i++ {
+		if resp := change("wrong-password-1"); resp.StatusCode != 403 {
+			t.Fatalf("wrong current password %d: got %d, want 403", i+1, resp.StatusCode)
+		}
+	}
+	if resp := change(testPassword); resp.StatusCode != 429 {
+		t.Errorf("change after %d failures: got %d, want 429", accountFreeFailures+1, resp.StatusCode)
+	}
+	if resp, _ := loginAs(t, testPassword); resp.StatusCode != 429 {
+		t.Errorf("login after failed changes: got %d, want 429", resp.StatusCode)
+	}
+}
+
+func TestRevokeOtherUsersSession(t *testing.T) {
+	db := setup(t)
+	ctx := context.Background()
+
+	_, body := loginAs(t, testPassword)
+	session, _ := auth.GetSession(ctx, db, body["token"].(string))
+
+	revoke := func(username string) rest.Response {
+		t.Helper()
+		resp, err := Handler(ctx, rest.Request{
+			Method:     "DELETE",
+			Resource:   "/auth/sessions/{id}",
+			PathParams: map[string]string{"id": session.SessionID},
+			Session:    &auth.Session{Username: username},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	if resp := revoke("mallory"); resp.StatusCode != 404 {
+		t.Fatalf("revoking another user's session: got %d, want 404", resp.StatusCode)
+	}
+	if denied, _ := db.RevokedTokens.All(ctx); len(denied) != 0 {
+		t.Errorf("another user's session was denylisted: %v", denied)
+	}
+	if resp := revoke("alice"); resp.StatusCode != 200 {
+		t.Fatalf("revoking own session: got %d %s, want 200", resp.StatusCode, resp.Body)
+	}
+	if _, valid := auth.GetSession(ctx, db, body["token"].(string)); valid {
+		t.Error("revoked session still valid")
+	}
+}
@@ -0,0 +1,133 @@
+package authn
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"strconv"
+	"time"
+
+	"agendum/internal/api/rest"
+	"agendum/pkg/auth"
+	"agendum/pkg/password"
+	"agendum/pkg/utils"
+)
+
+// Failed logins are counted per account (the normalized email, whether or
+// not an account exists for it) and per source IP. Past the free attempts,
+// each further failure locks the key for twice as long as the previous one,
+// up to maxLockout. Counters are forgotten failureWindow after the last
+// failure, and an account's counter is reset by a successful login.
+const (
+	accountFreeFailures = 5
+	ipFreeFailures      = 20
+	baseLockout         = 30 * time.Second
+	maxLockout          = 15 * time.Minute
+	failureWindow       = 24 * time.Hour
+)
+
+// dummyHash is compared against when no account matches the email, so an
+// unknown email costs the same hashing work as a wrong password
+var dummyHash, _ = password.Hash("agendum-no-such-user")
+
+type UnlockRequest struct {
+	Email string `json:"email"`
+	IP    string `json:"ip"`
+}
+
+func accountKey(email string) string {
+	return "account#" + utils.NormalizeEmail(email)
+}
+
+func ipKey(ip string) string {
+	return "ip#" + ip
+}
+
+// lockedFor returns how long the longest lock among keys still has to run
+func lockedFor(ctx context.Context, keys ...string) (time.Duration, error) {
+	var longest time.Duration
+	for _, key := range keys {
+		attempt, err := db.LoginAttempts.Get(ctx, key)
+		if err != nil {
+			return 0, err
+		}
+		if attempt == nil || attempt.LockedUntil == 0 {
+			continue
+		}
+		if remaining := time.Until(time.Unix(attempt.LockedUntil, 0)); remaining > longest {
+			longest = remaining
+		}
+	}
+	return longest, nil
+}
+
+// recordFailure counts a failed login against key and locks it once it has
+// used up its free attempts
+func recordFailure(ctx context.Context, key string, freeFailures int) error {
+	now := time.Now()
+	failures, err := db.LoginAttempts.AddFailure(ctx, key, now.Format(time.RFC3339), now.Add(failureWindow).Unix())
+	if err != nil {
+		return err
+	}
+	if failures <= freeFailures {
+		return nil
+	}
+
+	lockout := time.Duration(float64(baseLockout) * math.Pow(2, float64(failures-freeFailures-1)))
+	if lockout > maxLockout || lockout <= 0 {
+		lockout = maxLockout
+	}
+	return db.LoginAttempts.Lock(ctx, key, now.Add(lockout).Unix())
+}
+
+func clearFailures(ctx context.Context, key string) error {
+	return db.LoginAttempts.Clear(ctx, key)
+}
+
+func lockedResponse(retryAfter time.Duration) rest.Response {
+	resp := errorResponse(429, "Too many failed login attempts, try again later")
+	resp.Headers["Retry-After"] = strconv.Itoa(int(math.Ceil(retryAfter.Seconds())))
+	return resp
+}
+
+// requireAdmin checks that the user is a superadmin or staff, who may use
+// support endpoints. They must have two-factor authentication enabled to do
+// so.
+func requireAdmin(ctx context.Context, username string) (rest.Response, bool, error) {
+	user, err := db.Users.Get(ctx, username)
+	if err != nil {
+		return rest.Response{StatusCode: 500}, false, err
+	}
+	if user == nil || !auth.PrivilegedUserType(auth.NormalizeUserType(user.UserType)) {
+		return errorResponse(403, "Staff or superadmin access required"), false, nil
+	}
+	if !user.MFAEnabled {
+		return errorResponse(403, "Enable two-factor authentication to use admin endpoints"), false, nil
+	}
+	return rest.Response{}, true, nil
+}
+
+// unlock clears the failed-login counters and lock of an email, an IP, or both
+func unlock(ctx context.Context, username, body string) (rest.Response, error) {
+	if denied, ok, err := requireAdmin(ctx, username); !ok {
+		return denied, err
+	}
+
+	var req UnlockRequest
+	if err := json.Unmarshal([]byte(body), &req); err != nil || (utils.NormalizeEmail(req.Email) == "" && req.IP == "") {
+		return errorResponse(400, "email or ip is required"), nil
+	}
+
+	if utils.NormalizeEmail(req.Email) != "" {
+		if err := clearFailures(ctx, accountKey(req.Email)); err != nil {
+			return rest.Response{StatusCode: 500}, err
+		}
+	}
+	if req.IP != "" {
+		if err := clearFailures(ctx, ipKey(req.IP)); err != nil {
+			return rest.Response{StatusCode: 500}, err
+		}
+	}
+
+	return errorResponse(200, "Login unlocked"), nil
+}
@@ -0,0 +1,137 @@
+package authn
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+
+	"agendum/internal/api/rest"
+	"agendum/internal/store"
+	"agendum/pkg/auth"
+	"agendum/pkg/password"
+	"agendum/pkg/utils"
+)
+
+type LoginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// findUserByEmail looks a user up by the normalized email. Accounts created
+// before emails were normalized are still stored as typed, so it falls back
+// to the raw address.
+func findUserByEmail(ctx context.Context, email string) (*store.User, error) {
+	normalized := utils.NormalizeEmail(email)
+	user, err := db.Users.FindByEmail(ctx, normalized)
+	if err == nil && user == nil && strings.TrimSpace(email) != normalized {
+		user, err = db.Users.FindByEmail(ctx, strings.TrimSpace(email))
+	}
+	return user, err
+}
+
+func login(ctx context.Context, request rest.Request) (rest.Response, error) {
+	var loginReq LoginRequest
+	if err := json.Unmarshal([]byte(request.Body), &loginReq); err != nil {
+		return rest.Response{StatusCode: 400}, err
+	}
+
+	account, ip := accountKey(loginReq.Email), ipKey(request.SourceIP)
+	retryAfter, err := lockedFor(ctx, account, ip)
+	if err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+	if retryAfter > 0 {
+		return lockedResponse(retryAfter), nil
+	}
+
+	user, err := findUserByEmail(ctx, loginReq.Email)
+	if err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+
+	// Verify password, hashing even when the email is unknown so the
+	// response time doesn't reveal which emails have accounts. Accounts
+	// created through single sign-on have no password at all.
+	hash, hasPassword := dummyHash, false
+	if user != nil && user.Password != "" {
+		hash, hasPassword = user.Password, true
+	}
+	matched, needsRehash, err := password.Verify(loginReq.Password, hash)
+	if err != nil {
+		log.Printf("verifying password: %v", err)
+	}
+	if !matched || !hasPassword {
+		if err := recordFailure(ctx, account, accountFreeFailures); err != nil {
+			return rest.Response{StatusCode: 500}, err
+		}
+		if err := recordFailure(ctx, ip, ipFreeFailures); err != nil {
+			return rest.Response{StatusCode: 500}, err
+		}
+		return rest.Response{
+			StatusCode: 401,
+			Headers: map[string]string{
+				"Content-Type":                 "application/json",
+				"Access-Control-Allow-Origin":  "*",
+				"Access-Control-Allow-Headers": "Content-Type,X-Amz-Date,Authorization,X-Api-Key,X-Amz-Security-Token",
+				"Access-Control-Allow-Methods": "POST,OPTIONS",
+			},
+			Body: `{"message":"Invalid email or password"}`,
+		}, nil
+	}
+
+	username := user.Username
+
+	// The password is only known now, so this is when a hash in an older
+	// format or with weaker parameters can be upgraded
+	if needsRehash {
+		if err := rehashPassword(ctx, username, loginReq.Password, hash); err != nil {
+			log.Printf("rehashing password of %s: %v", username, err)
+		}
+	}
+
+	if !user.EmailVerified && !auth.UnverifiedReadOnly() {
+		return errorResponse(403, "Verify your email address before logging in"), nil
+	}
+
+	// Accounts with two-factor authentication get a challenge instead of a
+	// session; /auth/mfa/verify exchanges it together with a code, and
+	// clears the failures once that is right too
+	if user.MFAEnabled {
+		return mfaChallenge(ctx, username)
+	}
+
+	if err := clearFailures(ctx, account); err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+
+	return startSession(ctx, username, request.UserAgent)
+}
+
+// startSession issues the tokens of a new login
+func startSession(ctx context.Context, username, userAgent string) (rest.Response, error) {
+	tokens, err := issueTokens(ctx, sessionDetails{
+		SessionID: utils.GenerateID(),
+		Username:  username,
+		CreatedAt: time.Now().Format(time.RFC3339),
+		UserAgent: userAgent,
+	})
+	if err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+
+	tokens.Message = "Login successful"
+	responseBody, _ := json.Marshal(tokens)
+
+	return rest.Response{
+		StatusCode: 200,
+		Headers: map[string]string{
+			"Content-Type":                 "application/json",
+			"Access-Control-Allow-Origin":  "*",
+			"Access-Control-Allow-Headers": "Content-Type,X-Amz-Date,Authorization,X-Api-Key,X-Amz-Security-Token",
+			"Access-Control-Allow-Methods": "POST,OPTIONS",
+		},
+		Body: string(responseBody),
+	}, nil
+}
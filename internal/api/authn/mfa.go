@@ -0,0 +1,232 @@
+package authn
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"agendum/internal/api/rest"
+	"agendum/internal/store"
+	"agendum/pkg/auth"
+)
+
+const (
+	mfaChallengeTTL      = 5 * time.Minute
+	mfaChallengeAttempts = 5
+	recoveryCodeCount    = 10
+)
+
+type MFARequest struct {
+	Code string `json:"code"`
+}
+
+type MFAVerifyRequest struct {
+	MFAToken     string `json:"mfa_token"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// mfaEnroll starts enrollment by storing a pending secret. It only takes
+// effect once a code generated from it is confirmed.
+func mfaEnroll(ctx context.Context, username string) (rest.Response, error) {
+	user, err := db.Users.Get(ctx, username)
+	if err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+	if user == nil {
+		return errorResponse(404, "User not found"), nil
+	}
+	if user.MFAEnabled {
+		return errorResponse(409, "Two-factor authentication is already enabled"), nil
+	}
+
+	secret := auth.GenerateTOTPSecret()
+	err = db.Users.SetMFAPendingSecret(ctx, username, secret)
+	if err == store.ErrNotFound {
+		return errorResponse(404, "User not found"), nil
+	}
+	if err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+
+	account := username
+	if user.Email != "" {
+		account = user.Email
+	}
+
+	body, _ := json.Marshal(map[string]string{
+		"secret":      secret,
+		"otpauth_uri": auth.TOTPURI(secret, account),
+	})
+	return response(200, string(body)), nil
+}
+
+// mfaConfirm enables two-factor authentication once the user proves their
+// authenticator produces codes for the pending secret, and hands out
+// recovery codes. Only hashes of the recovery codes are stored.
+func mfaConfirm(ctx context.Context, username, body string) (rest.Response, error) {
+	var req MFARequest
+	if err := json.Unmarshal([]byte(body), &req); err != nil || req.Code == "" {
+		return errorResponse(400, "code is required"), nil
+	}
+
+	user, err := db.Users.Get(ctx, username)
+	if err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+	if user == nil {
+		return errorResponse(404, "User not found"), nil
+	}
+	if user.MFAEnabled {
+		return errorResponse(409, "Two-factor authentication is already enabled"), nil
+	}
+	pending := user.MFAPendingSecret
+	if pending == "" {
+		return errorResponse(400, "Start enrollment with /auth/mfa/enroll first"), nil
+	}
+
+	step, valid := auth.ValidateTOTP(pending, req.Code, time.Now())
+	if !valid {
+		return errorResponse(400, "Invalid code"), nil
+	}
+
+	codes := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = auth.HashToken(code)
+	}
+
+	err = db.Users.EnableMFA(ctx, username, pending, hashes, step)
+	if err == store.ErrConflict {
+		return errorResponse(409, "Enrollment changed, start again with /auth/mfa/enroll"), nil
+	}
+	if err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+
+	responseBody, _ := json.Marshal(map[string]interface{}{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+	return response(200, string(responseBody)), nil
+}
+
+// mfaChallenge answers a correct password for an account with two-factor
+// authentication
+func mfaChallenge(ctx context.Context, username string) (rest.Response, error) {
+	token, err := auth.IssueOneTimeToken(ctx, db, auth.OneTimeMFAChallenge, username, mfaChallengeTTL)
+	if err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"message":      "Two-factor authentication code required",
+		"mfa_required": true,
+		"mfa_token":    token,
+	})
+	return response(200, string(body)), nil
+}
+
+// mfaVerify finishes a two-factor login: the challenge token from /auth/login
+// plus either a current TOTP code or an unused recovery code. Wrong codes
+// count towards the account and IP lockouts just like wrong passwords.
+func mfaVerify(ctx context.Context, request rest.Request) (rest.Response, error) {
+	var req MFAVerifyRequest
+	if err := json.Unmarshal([]byte(request.Body), &req); err != nil || req.MFAToken == "" || (req.Code == "" && req.RecoveryCode == "") {
+		return errorResponse(400, "mfa_token and a code or recovery_code are required"), nil
+	}
+
+	challenge, valid := auth.GetOneTimeToken(ctx, db, auth.OneTimeMFAChallenge, req.MFAToken)
+	if !valid {
+		return errorResponse(401, "Invalid or expired MFA token"), nil
+	}
+
+	user, err := db.Users.Get(ctx, challenge.Username)
+	if err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+	if user == nil || !user.MFAEnabled {
+		return errorResponse(401, "Invalid or expired MFA token"), nil
+	}
+
+	account, ip := accountKey(user.Email), ipKey(request.SourceIP)
+	retryAfter, err := lockedFor(ctx, account, ip)
+	if err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+	if retryAfter > 0 {
+		return lockedResponse(retryAfter), nil
+	}
+
+	// The code is only checked here; it is used up once the challenge is
+	// consumed, so a challenge that can't be consumed costs no recovery code
+	use, accepted := checkSecondFactor(user, req)
+	if !accepted {
+		return mfaFailure(ctx, req.MFAToken, account, ip)
+	}
+
+	// Consuming the challenge makes sure it yields at most one session
+	if _, consumed, err := auth.ConsumeOneTimeToken(ctx, db, auth.OneTimeMFAChallenge, req.MFAToken); err != nil || !consumed {
+		if err != nil {
+			return rest.Response{StatusCode: 500}, err
+		}
+		return errorResponse(401, "Invalid or expired MFA token"), nil
+	}
+
+	// Fails when the code was used concurrently, such as a replayed TOTP
+	// code or a recovery code spent by another login
+	err = use(ctx)
+	if err == store.ErrConflict {
+		return mfaFailure(ctx, req.MFAToken, account, ip)
+	}
+	if err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+
+	if err := clearFailures(ctx, account); err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+
+	return startSession(ctx, challenge.Username, request.UserAgent)
+}
+
+// mfaFailure counts a wrong code against the challenge, the account and the
+// source IP
+func mfaFailure(ctx context.Context, mfaToken, account, ip string) (rest.Response, error) {
+	if err := auth.RecordOneTimeTokenFailure(ctx, db, mfaToken, mfaChallengeAttempts); err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+	if err := recordFailure(ctx, account, accountFreeFailures); err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+	if err := recordFailure(ctx, ip, ipFreeFailures); err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+	return errorResponse(401, "Invalid code"), nil
+}
+
+// checkSecondFactor checks a TOTP or recovery code without using it up. When
+// it is accepted, use marks it used: the TOTP step can't be replayed and the
+// recovery code is removed. use fails with store.ErrConflict if that already
+// happened.
+func checkSecondFactor(user *store.User, req MFAVerifyRequest) (use func(ctx context.Context) error, accepted bool) {
+	if req.RecoveryCode != "" {
+		hash := auth.HashToken(auth.NormalizeRecoveryCode(req.RecoveryCode))
+		for _, remaining := range user.MFARecoveryCodes {
+			if remaining == hash {
+				return func(ctx context.Context) error {
+					return db.Users.UseRecoveryCode(ctx, user.Username, hash)
+				}, true
+			}
+		}
+		return nil, false
+	}
+
+	step, valid := auth.ValidateTOTP(user.MFASecret, req.Code, time.Now())
+	if !valid || step <= user.MFALastStep {
+		return nil, false
+	}
+	return func(ctx context.Context) error {
+		return db.Users.AdvanceMFAStep(ctx, user.Username, step)
+	}, true
+}
@@ -0,0 +1,197 @@
+package authn
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"agendum/internal/api/rest"
+	"agendum/internal/store"
+	"agendum/pkg/auth"
+	"agendum/pkg/oidc"
+	"agendum/pkg/utils"
+)
+
+const oidcStateTTL = 10 * time.Minute
+
+type OIDCCallbackRequest struct {
+	Code  string `json:"code"`
+	State string `json:"state"`
+}
+
+// oidcProvider discovers the identity provider configured through
+// OIDC_ISSUER, OIDC_CLIENT_ID and OIDC_CLIENT_SECRET. It returns nil when
+// single sign-on isn't configured.
+func oidcProvider(ctx context.Context) (*oidc.Provider, error) {
+	issuer := os.Getenv("OIDC_ISSUER")
+	if issuer == "" || os.Getenv("OIDC_CLIENT_ID") == "" || os.Getenv("OIDC_REDIRECT_URL") == "" {
+		return nil, nil
+	}
+	return oidc.Discover(ctx, issuer, os.Getenv("OIDC_CLIENT_ID"), os.Getenv("OIDC_CLIENT_SECRET"))
+}
+
+// oidcLogin starts a single sign-on login. The state, nonce and PKCE
+// verifier are kept in a one-time token named by the state, so the callback
+// can only be completed once and only by the flow that started it.
+func oidcLogin(ctx context.Context) (rest.Response, error) {
+	provider, err := oidcProvider(ctx)
+	if err != nil {
+		return rest.Response{StatusCode: 502}, err
+	}
+	if provider == nil {
+		return errorResponse(404, "Single sign-on is not configured"), nil
+	}
+
+	nonce, verifier := oidc.RandomString(), oidc.RandomString()
+	state, err := auth.IssueOneTimeTokenWithData(ctx, db, auth.OneTimeOIDCState, "", oidcStateTTL, map[string]string{
+		"nonce":    nonce,
+		"verifier": verifier,
+	})
+	if err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+
+	body, _ := json.Marshal(map[string]string{
+		"authorization_url": provider.AuthorizationURL(os.Getenv("OIDC_REDIRECT_URL"), state, nonce, verifier),
+	})
+	return response(200, string(body)), nil
+}
+
+// oidcCallback finishes a single sign-on login with the code and state the
+// provider sent to OIDC_REDIRECT_URL, and starts a normal session for the
+// account with the verified email address
+func oidcCallback(ctx context.Context, request rest.Request) (rest.Response, error) {
+	var req OIDCCallbackRequest
+	if err := json.Unmarshal([]byte(request.Body), &req); err != nil || req.Code == "" || req.State == "" {
+		return errorResponse(400, "code and state are required"), nil
+	}
+
+	provider, err := oidcProvider(ctx)
+	if err != nil {
+		return rest.Response{StatusCode: 502}, err
+	}
+	if provider == nil {
+		return errorResponse(404, "Single sign-on is not configured"), nil
+	}
+
+	state, valid, err := auth.ConsumeOneTimeToken(ctx, db, auth.OneTimeOIDCState, req.State)
+	if err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+	if !valid {
+		return errorResponse(400, "Invalid or expired login state, start again"), nil
+	}
+
+	claims, err := provider.Exchange(ctx, req.Code, os.Getenv("OIDC_REDIRECT_URL"), state.Data["verifier"], state.Data["nonce"])
+	if err != nil {
+		log.Printf("single sign-on: %v", err)
+		return errorResponse(401, "Single sign-on failed"), nil
+	}
+
+	// Accounts are matched by email, so only addresses the provider vouches
+	// for can be used; anything else would let one take over another's account
+	email := utils.NormalizeEmail(claims.Email)
+	if email == "" || !claims.EmailVerified {
+		return errorResponse(403, "Your identity provider didn't supply a verified email address"), nil
+	}
+	subject := claims.Issuer + "|" + claims.Subject
+
+	// Like logging in with a password, this finds accounts stored before
+	// emails were normalized too
+	user, err := findUserByEmail(ctx, claims.Email)
+	if err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+
+	if user != nil {
+		if user.OIDCSubject != "" && user.OIDCSubject != subject {
+			return errorResponse(409, "This account is linked to a different single sign-on identity"), nil
+		}
+		err := db.Users.LinkOIDCSubject(ctx, user.Username, subject)
+		if err == store.ErrConflict {
+			return errorResponse(409, "This account is linked to a different single sign-on identity"), nil
+		}
+		if err != nil {
+			return rest.Response{StatusCode: 500}, err
+		}
+	} else {
+		if os.Getenv("OIDC_JIT_PROVISIONING") == "false" {
+			return errorResponse(403, "No account uses this email address"), nil
+		}
+		user, err = provisionOIDCUser(ctx, claims, email, subject)
+		if err != nil {
+			return rest.Response{StatusCode: 500}, err
+		}
+		if user == nil {
+			return errorResponse(409, "An account with this email already exists"), nil
+		}
+	}
+
+	if user.MFAEnabled {
+		return mfaChallenge(ctx, user.Username)
+	}
+	return startSession(ctx, user.Username, request.UserAgent)
+}
+
+// provisionOIDCUser creates an account on first single sign-on. The username
+// is taken from the email address, with a numeric suffix when it's taken. It
+// returns nil if the email was claimed in the meantime.
+func provisionOIDCUser(ctx context.Context, claims *oidc.Claims, email, subject string) (*store.User, error) {
+	base := usernameFromEmail(email)
+
+	for attempt := 0; attempt < 5; attempt++ {
+		username := base
+		if attempt > 0 {
+			n, _ := rand.Int(rand.Reader, big.NewInt(10000))
+			username = fmt.Sprintf("%s-%04d", base, n.Int64())
+		}
+
+		user := &store.User{
+			Username:      username,
+			Email:         email,
+			FirstName:     claims.GivenName,
+			LastName:      claims.FamilyName,
+			UserType:      auth.UserTypeStandard,
+			TeamIDs:       []string{},
+			EmailVerified: true,
+			OIDCSubject:   subject,
+		}
+
+		// Same pairing as signup, so the email can't end up on two accounts
+		err := db.Users.Create(ctx, user)
+		if err == store.ErrEmailTaken {
+			return nil, nil
+		}
+		if err == store.ErrUsernameTaken {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return user, nil
+	}
+
+	return nil, fmt.Errorf("no free username for %s", base)
+}
+
+// usernameFromEmail keeps the letters, digits, dots, dashes and underscores
+// of the email's local part
+func usernameFromEmail(email string) string {
+	local, _, _ := strings.Cut(email, "@")
+	var b strings.Builder
+	for _, r := range local {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '.' || r == '-' || r == '_' {
+			b.WriteRune(r)
+		}
+	}
+	if b.Len() == 0 {
+		return "user"
+	}
+	return b.String()
+}
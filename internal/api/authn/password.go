@@ -0,0 +1,240 @@
+package authn
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+
+	"agendum/internal/api/rest"
+	"agendum/internal/store"
+	"agendum/pkg/auth"
+	"agendum/pkg/mail"
+	"agendum/pkg/password"
+	"agendum/pkg/utils"
+)
+
+const passwordResetTTL = time.Hour
+
+// An account is sent a reset link at most once per resetInterval and
+// maxResets times per resetWindow, like verification emails
+const (
+	resetInterval = time.Minute
+	resetWindow   = 24 * time.Hour
+	maxResets     = 5
+)
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+// checkPolicy checks a new password for the user against the password policy
+func checkPolicy(user *store.User, newPassword string) error {
+	return password.PolicyFromEnv().Check(newPassword, user.Username, user.Email)
+}
+
+// policyResponse is a 400 naming the rule the password broke
+func policyResponse(err error) rest.Response {
+	body, _ := json.Marshal(err)
+	return response(400, string(body))
+}
+
+func setPassword(ctx context.Context, username, newPassword string) error {
+	hashedPassword, err := password.Hash(newPassword)
+	if err != nil {
+		return err
+	}
+	return db.Users.SetPassword(ctx, username, hashedPassword)
+}
+
+// rehashPassword replaces a stored hash with one in the preferred format.
+// It only applies if the hash is still the one that was verified, so a
+// password changed in the meantime is kept.
+func rehashPassword(ctx context.Context, username, plain, oldHash string) error {
+	hashedPassword, err := password.Hash(plain)
+	if err != nil {
+		return err
+	}
+
+	err = db.Users.ReplacePassword(ctx, username, oldHash, hashedPassword)
+	if err == store.ErrConflict {
+		return nil
+	}
+	return err
+}
+
+// changePassword replaces the caller's password and logs out their other
+// sessions, keeping the one that made the change
+func changePassword(ctx context.Context, current *auth.Session, body string) (rest.Response, error) {
+	var req ChangePasswordRequest
+	if err := json.Unmarshal([]byte(body), &req); err != nil || req.CurrentPassword == "" || req.NewPassword == "" {
+		return errorResponse(400, "current_password and new_password are required"), nil
+	}
+
+	user, err := db.Users.Get(ctx, current.Username)
+	if err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+	if user == nil {
+		return errorResponse(404, "User not found"), nil
+	}
+
+	// Accounts created through single sign-on start without a password
+	if user.Password == "" {
+		return errorResponse(409, "This account has no password yet, set one through /auth/password/forgot"), nil
+	}
+
+	// A stolen session mustn't be a way around the login lockout to guess
+	// the password, so wrong guesses count against the account here too
+	account := accountKey(user.Email)
+	retryAfter, err := lockedFor(ctx, account)
+	if err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+	if retryAfter > 0 {
+		return lockedResponse(retryAfter), nil
+	}
+	if matched, _, _ := password.Verify(req.CurrentPassword, user.Password); !matched {
+		if err := recordFailure(ctx, account, accountFreeFailures); err != nil {
+			return rest.Response{StatusCode: 500}, err
+		}
+		return errorResponse(403, "Current password is incorrect"), nil
+	}
+	if err := checkPolicy(user, req.NewPassword); err != nil {
+		return policyResponse(err), nil
+	}
+
+	if err := setPassword(ctx, current.Username, req.NewPassword); err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+	if err := auth.RevokeOtherSessions(ctx, db, current.Username, current.SessionID); err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+
+	return errorResponse(200, "Password changed"), nil
+}
+
+// forgotPassword emails a reset link if an account uses the email. The
+// response is the same either way so it can't be used to find accounts,
+// which is also why rate limited and failed sends are only logged.
+func forgotPassword(ctx context.Context, body string) (rest.Response, error) {
+	var req ForgotPasswordRequest
+	if err := json.Unmarshal([]byte(body), &req); err != nil || utils.NormalizeEmail(req.Email) == "" {
+		return errorResponse(400, "email is required"), nil
+	}
+
+	sent := errorResponse(202, "If an account uses this email, a reset link has been sent")
+
+	user, err := findUserByEmail(ctx, req.Email)
+	if err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+	if user == nil {
+		return sent, nil
+	}
+	username := user.Username
+
+	now := time.Now()
+	lastSent := user.ResetSentAt
+	windowStart := user.ResetWindowStart
+	sends := user.ResetSends
+
+	if now.Before(time.Unix(lastSent, 0).Add(resetInterval)) {
+		return sent, nil
+	}
+	if now.Sub(time.Unix(windowStart, 0)) >= resetWindow {
+		windowStart, sends = now.Unix(), 0
+	}
+	if sends >= maxResets {
+		return sent, nil
+	}
+
+	// Conditioned on the previous send time so concurrent requests can't
+	// both get through
+	err = db.Users.RecordPasswordResetSent(ctx, username, lastSent, now.Unix(), windowStart, sends+1)
+	if err == store.ErrConflict {
+		return sent, nil
+	}
+	if err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+
+	sender, err := mail.NewSender()
+	if err != nil {
+		log.Printf("sending password reset email to %s: %v", username, err)
+		return sent, nil
+	}
+
+	token, err := auth.IssueOneTimeToken(ctx, db, auth.OneTimePasswordReset, username, passwordResetTTL)
+	if err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+
+	err = sender.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Reset your Agendum password",
+		Body: "Someone asked to reset the password of your Agendum account " + username + ".\n\n" +
+			"Open this link within the next hour to choose a new one:\n" +
+			os.Getenv("APP_BASE_URL") + "/reset-password?token=" + token + "\n\n" +
+			"If it wasn't you, ignore this email; your password stays the same.",
+	})
+	if err != nil {
+		log.Printf("sending password reset email to %s: %v", username, err)
+	}
+
+	return sent, nil
+}
+
+// resetPassword sets a new password with a token from forgotPassword. The
+// token works once, and every session of the account is logged out.
+func resetPassword(ctx context.Context, body string) (rest.Response, error) {
+	var req ResetPasswordRequest
+	if err := json.Unmarshal([]byte(body), &req); err != nil || req.Token == "" || req.NewPassword == "" {
+		return errorResponse(400, "token and new_password are required"), nil
+	}
+
+	// Check the new password before using up the token, so a rejected
+	// password can be retried with the same link
+	reset, valid := auth.GetOneTimeToken(ctx, db, auth.OneTimePasswordReset, req.Token)
+	if !valid {
+		return errorResponse(400, "Invalid or expired reset token"), nil
+	}
+
+	user, err := db.Users.Get(ctx, reset.Username)
+	if err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+	if user == nil {
+		return errorResponse(400, "Invalid or expired reset token"), nil
+	}
+	if err := checkPolicy(user, req.NewPassword); err != nil {
+		return policyResponse(err), nil
+	}
+
+	if _, consumed, err := auth.ConsumeOneTimeToken(ctx, db, auth.OneTimePasswordReset, req.Token); err != nil || !consumed {
+		if err != nil {
+			return rest.Response{StatusCode: 500}, err
+		}
+		return errorResponse(400, "Invalid or expired reset token"), nil
+	}
+
+	if err := setPassword(ctx, reset.Username, req.NewPassword); err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+	if err := auth.RevokeUserSessions(ctx, db, reset.Username); err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+
+	return errorResponse(200, "Password reset"), nil
+}
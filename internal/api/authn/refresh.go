@@ -0,0 +1,53 @@
+package authn
+
+import (
+	"context"
+	"encoding/json"
+
+	"agendum/internal/api/rest"
+	"agendum/pkg/auth"
+)
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// refresh exchanges a refresh token for a new access and refresh token.
+// Refresh tokens are single use: presenting one that was already exchanged
+// means it leaked, so every token of that session is revoked.
+func refresh(ctx context.Context, request rest.Request) (rest.Response, error) {
+	var refreshReq RefreshRequest
+	if err := json.Unmarshal([]byte(request.Body), &refreshReq); err != nil || refreshReq.RefreshToken == "" {
+		return errorResponse(400, "refresh_token is required"), nil
+	}
+
+	current, valid := auth.GetRefreshToken(ctx, db, refreshReq.RefreshToken)
+	if !valid {
+		return errorResponse(401, "Invalid or expired refresh token"), nil
+	}
+
+	first, err := auth.MarkRefreshTokenUsed(ctx, db, current.Token)
+	if err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+	if !first {
+		if _, err := auth.RevokeSession(ctx, db, current.Username, current.SessionID); err != nil {
+			return rest.Response{StatusCode: 500}, err
+		}
+		return errorResponse(401, "Refresh token was already used; the session has been revoked"), nil
+	}
+
+	tokens, err := issueTokens(ctx, sessionDetails{
+		SessionID: current.SessionID,
+		Username:  current.Username,
+		CreatedAt: current.SessionCreatedAt,
+		UserAgent: current.UserAgent,
+	})
+	if err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+
+	tokens.Message = "Token refreshed"
+	body, _ := json.Marshal(tokens)
+	return response(200, string(body)), nil
+}
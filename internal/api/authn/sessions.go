@@ -0,0 +1,66 @@
+package authn
+
+import (
+	"context"
+	"encoding/json"
+
+	"agendum/internal/api/rest"
+	"agendum/pkg/auth"
+)
+
+type SessionInfo struct {
+	SessionID string `json:"session_id"`
+	CreatedAt string `json:"created_at"`
+	ExpiresAt string `json:"expires_at"`
+	UserAgent string `json:"user_agent"`
+	Current   bool   `json:"current"`
+}
+
+// logout revokes the token presented with the request, along with the
+// refresh tokens issued for the same login
+func logout(ctx context.Context, current *auth.Session) (rest.Response, error) {
+	if _, err := auth.RevokeSession(ctx, db, current.Username, current.SessionID); err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+	return response(200, `{"message":"Logged out"}`), nil
+}
+
+func listSessions(ctx context.Context, current *auth.Session) (rest.Response, error) {
+	sessions, err := auth.ListUserSessions(ctx, db, current.Username)
+	if err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+
+	infos := []SessionInfo{}
+	for _, s := range sessions {
+		infos = append(infos, SessionInfo{
+			SessionID: s.SessionID,
+			CreatedAt: s.CreatedAt,
+			ExpiresAt: s.ExpiresAt,
+			UserAgent: s.UserAgent,
+			Current:   s.SessionID == current.SessionID,
+		})
+	}
+
+	body, _ := json.Marshal(infos)
+	return response(200, string(body)), nil
+}
+
+// revokeAllSessions logs the user out everywhere, including the current session
+func revokeAllSessions(ctx context.Context, current *auth.Session) (rest.Response, error) {
+	if err := auth.RevokeUserSessions(ctx, db, current.Username); err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+	return response(200, `{"message":"Logged out of all sessions"}`), nil
+}
+
+func revokeSession(ctx context.Context, current *auth.Session, sessionID string) (rest.Response, error) {
+	found, err := auth.RevokeSession(ctx, db, current.Username, sessionID)
+	if err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+	if !found {
+		return errorResponse(404, "Session not found"), nil
+	}
+	return response(200, `{"message":"Session revoked"}`), nil
+}
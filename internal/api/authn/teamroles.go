@@ -0,0 +1,41 @@
+package authn
+
+import (
+	"context"
+	"errors"
+
+	"agendum/internal/store"
+)
+
+// teamRoles returns "admin" or "member" for every team the user belongs to,
+// to be embedded in JWT access tokens
+func teamRoles(ctx context.Context, username string) (map[string]string, error) {
+	roles := make(map[string]string)
+	user, err := db.Users.Get(ctx, username)
+	if err != nil || user == nil {
+		return roles, err
+	}
+
+	teams, failed := db.Teams.GetMany(ctx, user.TeamIDs)
+	if len(failed) > 0 {
+		return nil, errors.New("could not load all teams to build token roles")
+	}
+	for _, team := range teams {
+		addRoles(roles, team, username)
+	}
+
+	return roles, nil
+}
+
+func addRoles(roles map[string]string, team *store.Team, username string) {
+	for _, member := range team.Members {
+		if member == username {
+			roles[team.TeamID] = "member"
+		}
+	}
+	for _, admin := range team.Admins {
+		if admin == username {
+			roles[team.TeamID] = "admin"
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package authn
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"time"
+
+	"agendum/internal/store"
+	"agendum/pkg/auth"
+	"agendum/pkg/utils"
+)
+
+const (
+	defaultAccessTokenTTL  = time.Hour
+	defaultRefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+type TokenResponse struct {
+	Message      string `json:"message"`
+	Token        string `json:"token"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+func generateToken() string {
+	bytes := make([]byte, 32)
+	rand.Read(bytes)
+	return base64.URLEncoding.EncodeToString(bytes)
+}
+
+// lifetime reads a duration such as "15m" or "720h" from the environment
+func lifetime(name string, fallback time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(name)); err == nil && d > 0 {
+		return d
+	}
+	return fallback
+}
+
+// CheckConfig validates the token lifetimes, so a bad deployment fails at
+// cold start instead of issuing tokens that can't be revoked
+func CheckConfig() error {
+	return auth.CheckAccessTokenTTL(lifetime("ACCESS_TOKEN_TTL", defaultAccessTokenTTL))
+}
+
+// sessionDetails describes the login a token pair belongs to; it is carried
+// over unchanged every time the refresh token is rotated
+type sessionDetails struct {
+	SessionID string
+	Username  string
+	CreatedAt string
+	UserAgent string
+	// ReadOnly is worked out again at every refresh, so it lifts once the
+	// user verifies their email
+	ReadOnly bool
+}
+
+// issueTokens stores a new access token and refresh token for the session
+func issueTokens(ctx context.Context, details sessionDetails) (TokenResponse, error) {
+	if auth.UnverifiedReadOnly() {
+		user, err := db.Users.Get(ctx, details.Username)
+		if err != nil {
+			return TokenResponse{}, err
+		}
+		details.ReadOnly = user != nil && !user.EmailVerified
+	}
+
+	now := time.Now()
+	accessTTL := lifetime("ACCESS_TOKEN_TTL", defaultAccessTokenTTL)
+	accessExpiresAt := now.Add(accessTTL)
+	refreshExpiresAt := now.Add(lifetime("REFRESH_TOKEN_TTL", defaultRefreshTokenTTL))
+
+	var accessToken string
+	var err error
+	if auth.JWTMode() {
+		accessToken, err = issueJWT(ctx, details, now, accessExpiresAt)
+	} else {
+		accessToken, err = issueSessionToken(ctx, details, accessExpiresAt)
+	}
+	if err != nil {
+		return TokenResponse{}, err
+	}
+
+	refreshToken := generateToken()
+	err = db.RefreshTokens.Put(ctx, &store.RefreshToken{
+		Token:            auth.HashToken(refreshToken),
+		SessionID:        details.SessionID,
+		Username:         details.Username,
+		SessionCreatedAt: details.CreatedAt,
+		UserAgent:        details.UserAgent,
+		ExpiresAtEpoch:   refreshExpiresAt.Unix(),
+	})
+	if err != nil {
+		return TokenResponse{}, err
+	}
+
+	return TokenResponse{
+		Token:        accessToken,
+		ExpiresIn:    int64(accessTTL / time.Second),
+		RefreshToken: refreshToken,
+	}, nil
+}
+
+// issueSessionToken stores the hash of an opaque access token in the
+// Sessions table and returns the token itself
+func issueSessionToken(ctx context.Context, details sessionDetails, expiresAt time.Time) (string, error) {
+	token := generateToken()
+
+	err := db.Sessions.Put(ctx, &store.Session{
+		Token:          auth.HashToken(token),
+		SessionID:      details.SessionID,
+		Username:       details.Username,
+		CreatedAt:      details.CreatedAt,
+		ExpiresAt:      expiresAt.Format(time.RFC3339),
+		UserAgent:      details.UserAgent,
+		ExpiresAtEpoch: expiresAt.Unix(),
+		ReadOnly:       details.ReadOnly,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// issueJWT mints a signed access token carrying the user's current team roles;
+// nothing is stored, so role changes show up at the next refresh
+func issueJWT(ctx context.Context, details sessionDetails, issuedAt, expiresAt time.Time) (string, error) {
+	roles, err := teamRoles(ctx, details.Username)
+	if err != nil {
+		return "", err
+	}
+
+	return auth.IssueJWT(auth.Claims{
+		Issuer:    auth.JWTIssuer,
+		Subject:   details.Username,
+		ID:        utils.GenerateID(),
+		SessionID: details.SessionID,
+		IssuedAt:  issuedAt.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+		TeamRoles: roles,
+		ReadOnly:  details.ReadOnly,
+	})
+}
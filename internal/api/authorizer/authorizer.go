@@ -0,0 +1,128 @@
+// Package authorizer is the API Gateway token authorizer that every
+// protected route goes through.
+package authorizer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+
+	"agendum/internal/store"
+	"agendum/pkg/auth"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+var db *store.Store
+
+// SetStore sets the store the handlers read and write
+func SetStore(s *store.Store) {
+	db = s
+}
+
+// Handler validates the bearer token once for API Gateway, which caches the
+// decision per token and hands the session to the route's function through
+// the request context (see auth.SessionFromAuthorizer)
+func Handler(ctx context.Context, request events.APIGatewayCustomAuthorizerRequest) (events.APIGatewayCustomAuthorizerResponse, error) {
+	token := request.AuthorizationToken
+
+	// Remove "Bearer " prefix if present
+	if strings.HasPrefix(token, "Bearer ") {
+		token = token[7:]
+	}
+
+	current, valid := auth.GetSession(ctx, db, token)
+	if !valid {
+		// API Gateway turns this exact message into a 401
+		return events.APIGatewayCustomAuthorizerResponse{}, errors.New("Unauthorized")
+	}
+
+	authContext := map[string]interface{}{
+		"username":   current.Username,
+		"session_id": current.SessionID,
+		"expires_at": current.ExpiresAt,
+		"read_only":  strconv.FormatBool(current.ReadOnly),
+	}
+	if current.TeamRoles != nil {
+		roles, _ := json.Marshal(current.TeamRoles)
+		authContext["team_roles"] = string(roles)
+	}
+	if current.Scopes != nil {
+		authContext["scopes"] = strings.Join(current.Scopes, " ")
+	} else {
+		// Read on every authorization, so a role change applies once the
+		// cached decision expires rather than at the next login
+		userType, err := auth.GetUserType(ctx, db, current.Username)
+		if err != nil {
+			return events.APIGatewayCustomAuthorizerResponse{}, err
+		}
+		authContext["user_type"] = userType
+	}
+
+	return events.APIGatewayCustomAuthorizerResponse{
+		PrincipalID:    current.Username,
+		PolicyDocument: policy(request.MethodArn, current),
+		Context:        authContext,
+	}, nil
+}
+
+// scopeRoutes maps each personal access token scope to the methods it opens,
+// relative to the API stage. Each lists its own resources, so routes added
+// later stay closed to tokens until a scope names them.
+var scopeRoutes = map[string][]string{
+	auth.ScopeWriteTasks:  {"POST/tasks/*"},
+	auth.ScopeManageTeams: {"POST/teams/*", "PUT/teams/*"},
+}
+
+// policy is what the session may call: every method of the API, only reads
+// plus logout for read-only sessions, and what the scopes of a personal
+// access token open, never including token and account management
+func policy(methodArn string, current *auth.Session) events.APIGatewayCustomAuthorizerPolicy {
+	stage := strings.TrimSuffix(apiWildcardArn(methodArn), "*")
+
+	var allowed, denied []string
+	switch {
+	case current.Scopes != nil:
+		for _, scope := range current.Scopes {
+			for _, route := range scopeRoutes[scope] {
+				allowed = append(allowed, stage+route)
+			}
+		}
+		denied = []string{stage + "*/auth/*", stage + "*/tokens", stage + "*/tokens/*", stage + "*/service-accounts"}
+	case current.ReadOnly:
+		allowed = []string{stage + "GET/*", stage + "POST/auth/logout"}
+	default:
+		allowed = []string{stage + "*"}
+	}
+
+	doc := events.APIGatewayCustomAuthorizerPolicy{Version: "2012-10-17"}
+	if len(allowed) > 0 {
+		doc.Statement = append(doc.Statement, events.IAMPolicyStatement{
+			Action:   []string{"execute-api:Invoke"},
+			Effect:   "Allow",
+			Resource: allowed,
+		})
+	}
+	if len(denied) > 0 {
+		doc.Statement = append(doc.Statement, events.IAMPolicyStatement{
+			Action:   []string{"execute-api:Invoke"},
+			Effect:   "Deny",
+			Resource: denied,
+		})
+	}
+	return doc
+}
+
+// apiWildcardArn widens the ARN of the method being called to every method of
+// the same API stage. The cached policy is reused for any route the token
+// calls next, so it must not be limited to the first one.
+func apiWildcardArn(methodArn string) string {
+	// arn:aws:execute-api:region:account:api-id/stage/METHOD/resource/path
+	parts := strings.SplitN(methodArn, "/", 3)
+	if len(parts) < 2 {
+		return methodArn
+	}
+	return parts[0] + "/" + parts[1] + "/*"
+}
@@ -0,0 +1,197 @@
+// Package listteams serves GET /teams/list.
+package listteams
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+	"strconv"
+
+	"agendum/internal/api/rest"
+	"agendum/internal/store"
+)
+
+const (
+	defaultPageSize = 25
+	maxPageSize     = 100
+)
+
+var db *store.Store
+
+// SetStore sets the store the handlers read and write
+func SetStore(s *store.Store) {
+	db = s
+}
+
+type Team struct {
+	TeamID  string   `json:"team_id"`
+	Name    string   `json:"name"`
+	Admins  []string `json:"admins"`
+	Members []string `json:"members"`
+}
+
+// UnavailableTeam is a team the user belongs to that could not be loaded.
+// Reason is "not_found", "throttled" or "error".
+type UnavailableTeam struct {
+	TeamID string `json:"team_id"`
+	Reason string `json:"reason"`
+}
+
+type ListTeamsResponse struct {
+	Teams       []Team            `json:"teams"`
+	Unavailable []UnavailableTeam `json:"unavailable"`
+	NextToken   string            `json:"next_token,omitempty"`
+}
+
+// Handler lists the teams the caller belongs to
+func Handler(ctx context.Context, request rest.Request) (rest.Response, error) {
+	// The authorizer has already validated the token
+	current, valid := request.Authenticated()
+	if !valid {
+		return rest.Response{
+			StatusCode: 401,
+			Headers: map[string]string{
+				"Content-Type":                 "application/json",
+				"Access-Control-Allow-Origin":  "*",
+				"Access-Control-Allow-Headers": "Content-Type,X-Amz-Date,Authorization,X-Api-Key,X-Amz-Security-Token",
+				"Access-Control-Allow-Methods": "GET,OPTIONS",
+			},
+			Body: `{"message":"Invalid or expired token"}`,
+		}, nil
+	}
+
+	username := current.Username
+
+	// Get user's team IDs
+	user, err := db.Users.Get(ctx, username)
+	if err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+
+	if user == nil {
+		return rest.Response{
+			StatusCode: 404,
+			Headers: map[string]string{
+				"Content-Type":                 "application/json",
+				"Access-Control-Allow-Origin":  "*",
+				"Access-Control-Allow-Headers": "Content-Type,X-Amz-Date,Authorization,X-Api-Key,X-Amz-Security-Token",
+				"Access-Control-Allow-Methods": "GET,OPTIONS",
+			},
+			Body: `{"message":"User not found"}`,
+		}, nil
+	}
+
+	teamIDs := user.TeamIDs
+
+	limit := defaultPageSize
+	if limitParam := request.Query["limit"]; limitParam != "" {
+		limit, err = strconv.Atoi(limitParam)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			return rest.Response{
+				StatusCode: 400,
+				Headers: map[string]string{
+					"Content-Type":                 "application/json",
+					"Access-Control-Allow-Origin":  "*",
+					"Access-Control-Allow-Headers": "Content-Type,X-Amz-Date,Authorization,X-Api-Key,X-Amz-Security-Token",
+					"Access-Control-Allow-Methods": "GET,OPTIONS",
+				},
+				Body: `{"message":"limit must be between 1 and ` + strconv.Itoa(maxPageSize) + `"}`,
+			}, nil
+		}
+	}
+
+	pageIDs, nextToken, err := paginate(teamIDs, request.Query["next_token"], limit)
+	if err != nil {
+		return rest.Response{
+			StatusCode: 400,
+			Headers: map[string]string{
+				"Content-Type":                 "application/json",
+				"Access-Control-Allow-Origin":  "*",
+				"Access-Control-Allow-Headers": "Content-Type,X-Amz-Date,Authorization,X-Api-Key,X-Amz-Security-Token",
+				"Access-Control-Allow-Methods": "GET,OPTIONS",
+			},
+			Body: `{"message":"Invalid next_token"}`,
+		}, nil
+	}
+
+	teams, unavailable := getTeams(ctx, pageIDs)
+
+	response, _ := json.Marshal(ListTeamsResponse{
+		Teams:       teams,
+		Unavailable: unavailable,
+		NextToken:   nextToken,
+	})
+	return rest.Response{
+		StatusCode: 200,
+		Headers: map[string]string{
+			"Content-Type":                 "application/json",
+			"Access-Control-Allow-Origin":  "*",
+			"Access-Control-Allow-Headers": "Content-Type,X-Amz-Date,Authorization,X-Api-Key,X-Amz-Security-Token",
+			"Access-Control-Allow-Methods": "GET,OPTIONS",
+		},
+		Body: string(response),
+	}, nil
+}
+
+// paginate sorts and de-duplicates the team IDs and returns the page that
+// follows the team ID encoded in nextToken, plus the token for the page after it
+func paginate(teamIDs []string, nextToken string, limit int) ([]string, string, error) {
+	sorted := make([]string, 0, len(teamIDs))
+	seen := make(map[string]bool)
+	for _, teamID := range teamIDs {
+		if !seen[teamID] {
+			seen[teamID] = true
+			sorted = append(sorted, teamID)
+		}
+	}
+	sort.Strings(sorted)
+
+	start := 0
+	if nextToken != "" {
+		after, err := base64.RawURLEncoding.DecodeString(nextToken)
+		if err != nil {
+			return nil, "", err
+		}
+		start = sort.SearchStrings(sorted, string(after))
+		if start < len(sorted) && sorted[start] == string(after) {
+			start++
+		}
+	}
+
+	end := start + limit
+	if end >= len(sorted) {
+		return sorted[start:], "", nil
+	}
+
+	return sorted[start:end], base64.RawURLEncoding.EncodeToString([]byte(sorted[end-1])), nil
+}
+
+// getTeams loads the given teams in the order of teamIDs; the ones that could
+// not be loaded are reported instead of dropped
+func getTeams(ctx context.Context, teamIDs []string) ([]Team, []UnavailableTeam) {
+	loaded, failed := db.Teams.GetMany(ctx, teamIDs)
+
+	teams := []Team{}
+	unavailable := []UnavailableTeam{}
+	for _, teamID := range teamIDs {
+		if team, ok := loaded[teamID]; ok {
+			teams = append(teams, Team{
+				TeamID:  team.TeamID,
+				Name:    team.Name,
+				Admins:  team.Admins,
+				Members: team.Members,
+			})
+		} else if err, ok := failed[teamID]; ok {
+			reason := "error"
+			if err == store.ErrThrottled {
+				reason = "throttled"
+			}
+			unavailable = append(unavailable, UnavailableTeam{TeamID: teamID, Reason: reason})
+		} else {
+			unavailable = append(unavailable, UnavailableTeam{TeamID: teamID, Reason: "not_found"})
+		}
+	}
+
+	return teams, unavailable
+}
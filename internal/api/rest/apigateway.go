@@ -0,0 +1,46 @@
+package rest
+
+import (
+	"context"
+
+	"agendum/pkg/auth"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Lambda adapts a handler to API Gateway's Lambda proxy integration
+func Lambda(h HandlerFunc) func(context.Context, events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	return func(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		response, err := h(ctx, FromAPIGateway(event))
+		return ToAPIGateway(response), err
+	}
+}
+
+// FromAPIGateway turns a proxy event into a Request, taking the session from
+// the context the API Gateway authorizer attached
+func FromAPIGateway(event events.APIGatewayProxyRequest) Request {
+	request := Request{
+		Method:     event.HTTPMethod,
+		Resource:   event.Resource,
+		Path:       event.Path,
+		PathParams: event.PathParameters,
+		Query:      event.QueryStringParameters,
+		Headers:    event.Headers,
+		Body:       event.Body,
+		SourceIP:   event.RequestContext.Identity.SourceIP,
+		UserAgent:  event.RequestContext.Identity.UserAgent,
+	}
+	if current, valid := auth.SessionFromAuthorizer(event.RequestContext.Authorizer); valid {
+		request.Session = current
+	}
+	return request
+}
+
+// ToAPIGateway turns a Response into what a proxy integration returns
+func ToAPIGateway(response Response) events.APIGatewayProxyResponse {
+	return events.APIGatewayProxyResponse{
+		StatusCode: response.StatusCode,
+		Headers:    response.Headers,
+		Body:       response.Body,
+	}
+}
@@ -0,0 +1,57 @@
+package rest
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// FromHTTP turns a net/http request for the route at resource into a
+// Request. The caller authorizes it and sets Session.
+func FromHTTP(r *http.Request, resource string, pathParams map[string]string) (Request, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return Request{}, err
+	}
+
+	headers := make(map[string]string)
+	for name, values := range r.Header {
+		headers[name] = strings.Join(values, ",")
+	}
+	query := make(map[string]string)
+	for name, values := range r.URL.Query() {
+		query[name] = values[len(values)-1]
+	}
+	sourceIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		sourceIP = r.RemoteAddr
+	}
+
+	return Request{
+		Method:     r.Method,
+		Resource:   resource,
+		Path:       r.URL.Path,
+		PathParams: pathParams,
+		Query:      query,
+		Headers:    headers,
+		Body:       string(body),
+		SourceIP:   sourceIP,
+		UserAgent:  r.UserAgent(),
+	}, nil
+}
+
+// WriteHTTP writes a Response to a net/http client
+func WriteHTTP(w http.ResponseWriter, response Response) {
+	for name, value := range response.Headers {
+		w.Header().Set(name, value)
+	}
+
+	// WriteHeader panics on 0, which a handler forgetting the status would give
+	status := response.StatusCode
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	io.WriteString(w, response.Body)
+}
@@ -0,0 +1,48 @@
+// Package rest is the transport-agnostic shape of the API's handlers. A
+// handler takes a Request and returns a Response, and adapters build those
+// from API Gateway events in Lambda and from net/http in cmd/server, so both
+// deployments run exactly the same code.
+package rest
+
+import (
+	"context"
+
+	"agendum/pkg/auth"
+)
+
+// HandlerFunc is the signature of every route's handler
+type HandlerFunc func(ctx context.Context, request Request) (Response, error)
+
+// Request is an API call, however it arrived
+type Request struct {
+	Method string
+	// Resource is the route's path template, such as /users/{username}
+	Resource   string
+	Path       string
+	PathParams map[string]string
+	// Query holds the last value of each query string parameter
+	Query   map[string]string
+	Headers map[string]string
+	Body    string
+
+	SourceIP  string
+	UserAgent string
+
+	// Session is who the authorizer validated the token of, on protected
+	// routes
+	Session *auth.Session
+}
+
+// Authenticated returns the session the authorizer validated, if any
+func (r Request) Authenticated() (*auth.Session, bool) {
+	return r.Session, r.Session != nil
+}
+
+// Response is a handler's answer. Handlers that fail return a Response
+// along with the error, which adapters log and answer with a 502 like API
+// Gateway does.
+type Response struct {
+	StatusCode int
+	Headers    map[string]string
+	Body       string
+}
@@ -0,0 +1,228 @@
+// Package task serves POST /tasks/create.
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"agendum/internal/api/rest"
+	"agendum/internal/store"
+	"agendum/pkg/teams"
+	"agendum/pkg/utils"
+)
+
+var db *store.Store
+
+// SetStore sets the store the handlers read and write
+func SetStore(s *store.Store) {
+	db = s
+}
+
+type TimeSlot struct {
+	BeginTime string `json:"begin_time"`
+	EndTime   string `json:"end_time"`
+}
+
+type WeeklySchedule struct {
+	Monday    *TimeSlot `json:"monday,omitempty"`
+	Tuesday   *TimeSlot `json:"tuesday,omitempty"`
+	Wednesday *TimeSlot `json:"wednesday,omitempty"`
+	Thursday  *TimeSlot `json:"thursday,omitempty"`
+	Friday    *TimeSlot `json:"friday,omitempty"`
+	Saturday  *TimeSlot `json:"saturday,omitempty"`
+	Sunday    *TimeSlot `json:"sunday,omitempty"`
+}
+
+// days returns the schedule's slots keyed by weekday name
+func (s *WeeklySchedule) days() map[string]*TimeSlot {
+	return map[string]*TimeSlot{
+		"monday":    s.Monday,
+		"tuesday":   s.Tuesday,
+		"wednesday": s.Wednesday,
+		"thursday":  s.Thursday,
+		"friday":    s.Friday,
+		"saturday":  s.Saturday,
+		"sunday":    s.Sunday,
+	}
+}
+
+type Task struct {
+	Title     string          `json:"title"`
+	TeamID    string          `json:"team_id"`
+	Schedule  *WeeklySchedule `json:"schedule"`
+	TaskType  string          `json:"task_type"`
+	TimeZone  string          `json:"time_zone"`
+	Requester string          `json:"requester"`
+}
+
+// applyTeamSettings fills in the fields the request left empty from the team's
+// settings. Tasks that fall outside the team's constraints are rejected when
+// enforce is set, which is only the case for teams that saved their settings.
+// Slots in another time zone than the team's are checked once converted to
+// the team's. Days are checked in the order of the team's week, so the
+// first problem reported is the earliest one in that week.
+func applyTeamSettings(task *Task, settings *teams.Settings, enforce bool, now time.Time) error {
+	if task.TimeZone == "" {
+		task.TimeZone = settings.TimeZone
+	} else if _, err := time.LoadLocation(task.TimeZone); err != nil {
+		return fmt.Errorf("unknown time zone %q", task.TimeZone)
+	}
+
+	if task.TaskType == "" && len(settings.AllowedTaskTypes) > 0 {
+		task.TaskType = settings.AllowedTaskTypes[0]
+	}
+	if enforce {
+		if err := settings.CheckTaskType(task.TaskType); err != nil {
+			return err
+		}
+	}
+
+	if task.Schedule == nil {
+		return fmt.Errorf("schedule is required")
+	}
+
+	days := task.Schedule.days()
+	for _, day := range settings.OrderedWeekdays() {
+		slot := days[day]
+		if slot == nil {
+			continue
+		}
+		if slot.EndTime == "" {
+			endTime, err := settings.DefaultEndTime(slot.BeginTime)
+			if err != nil {
+				return fmt.Errorf("%s: %v", day, err)
+			}
+			slot.EndTime = endTime
+		}
+		if !enforce {
+			continue
+		}
+
+		checkDay, beginTime, endTime := day, slot.BeginTime, slot.EndTime
+		if task.TimeZone != settings.TimeZone {
+			var err error
+			checkDay, beginTime, endTime, err = settings.ConvertSlot(task.TimeZone, day, slot.BeginTime, slot.EndTime, now)
+			if err != nil {
+				return err
+			}
+		}
+		if err := settings.CheckSlot(checkDay, beginTime, endTime); err != nil {
+			if task.TimeZone != settings.TimeZone {
+				return fmt.Errorf("%s %s-%s in %s: %v", day, slot.BeginTime, slot.EndTime, task.TimeZone, err)
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Handler creates a task in a team the caller belongs to
+func Handler(ctx context.Context, request rest.Request) (rest.Response, error) {
+	// The authorizer has already validated the token
+	current, valid := request.Authenticated()
+	if !valid {
+		return rest.Response{
+			StatusCode: 401,
+			Headers: map[string]string{
+				"Content-Type":                 "application/json",
+				"Access-Control-Allow-Origin":  "*",
+				"Access-Control-Allow-Headers": "Content-Type,X-Amz-Date,Authorization,X-Api-Key,X-Amz-Security-Token",
+				"Access-Control-Allow-Methods": "POST,OPTIONS",
+			},
+			Body: `{"message":"Invalid or expired token"}`,
+		}, nil
+	}
+
+	var task Task
+	if err := json.Unmarshal([]byte(request.Body), &task); err != nil {
+		return rest.Response{StatusCode: 400}, err
+	}
+
+	// Set requester to authenticated username
+	task.Requester = current.Username
+
+	// Check if user is admin of the team
+	if !current.IsTeamAdmin(ctx, db, task.TeamID) {
+		return rest.Response{
+			StatusCode: 403,
+			Headers: map[string]string{
+				"Content-Type":                 "application/json",
+				"Access-Control-Allow-Origin":  "*",
+				"Access-Control-Allow-Headers": "Content-Type,X-Amz-Date,Authorization,X-Api-Key,X-Amz-Security-Token",
+				"Access-Control-Allow-Methods": "POST,OPTIONS",
+			},
+			Body: `{"message":"Only team admins can create tasks"}`,
+		}, nil
+	}
+
+	// Superadmins get past the admin check for teams that don't exist
+	settings, saved, err := teams.GetSettings(ctx, db, task.TeamID)
+	if err == teams.ErrTeamNotFound {
+		return rest.Response{
+			StatusCode: 404,
+			Headers: map[string]string{
+				"Content-Type":                 "application/json",
+				"Access-Control-Allow-Origin":  "*",
+				"Access-Control-Allow-Headers": "Content-Type,X-Amz-Date,Authorization,X-Api-Key,X-Amz-Security-Token",
+				"Access-Control-Allow-Methods": "POST,OPTIONS",
+			},
+			Body: `{"message":"Team not found"}`,
+		}, nil
+	}
+	if err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+
+	if err := applyTeamSettings(&task, settings, saved, time.Now()); err != nil {
+		body, _ := json.Marshal(map[string]string{"message": err.Error()})
+		return rest.Response{
+			StatusCode: 400,
+			Headers: map[string]string{
+				"Content-Type":                 "application/json",
+				"Access-Control-Allow-Origin":  "*",
+				"Access-Control-Allow-Headers": "Content-Type,X-Amz-Date,Authorization,X-Api-Key,X-Amz-Security-Token",
+				"Access-Control-Allow-Methods": "POST,OPTIONS",
+			},
+			Body: string(body),
+		}, nil
+	}
+
+	taskID := utils.GenerateID()
+	createdTimestamp := time.Now().Format(time.RFC3339)
+
+	schedule := make(map[string]store.TimeSlot)
+	for day, slot := range task.Schedule.days() {
+		if slot != nil {
+			schedule[day] = store.TimeSlot{BeginTime: slot.BeginTime, EndTime: slot.EndTime}
+		}
+	}
+
+	err = db.Tasks.Create(ctx, &store.Task{
+		TaskID:           taskID,
+		Title:            task.Title,
+		TeamID:           task.TeamID,
+		CreatedTimestamp: createdTimestamp,
+		Schedule:         schedule,
+		TaskType:         task.TaskType,
+		TimeZone:         task.TimeZone,
+		Requester:        task.Requester,
+	})
+
+	if err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+
+	return rest.Response{
+		StatusCode: 201,
+		Headers: map[string]string{
+			"Content-Type":                 "application/json",
+			"Access-Control-Allow-Origin":  "*",
+			"Access-Control-Allow-Headers": "Content-Type,X-Amz-Date,Authorization,X-Api-Key,X-Amz-Security-Token",
+			"Access-Control-Allow-Methods": "POST,OPTIONS",
+		},
+		Body: `{"message":"Task created successfully","task_id":"` + taskID + `"}`,
+	}, nil
+}
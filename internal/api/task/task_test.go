@@ -0,0 +1,153 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"agendum/internal/api/rest"
+	"agendum/internal/store"
+	"agendum/internal/store/memory"
+	"agendum/pkg/auth"
+	"agendum/pkg/teams"
+)
+
+// setup points the handler at a memory store holding team-1, with alice as
+// its admin
+func setup(t *testing.T) *store.Store {
+	t.Helper()
+	s := memory.New()
+	SetStore(s)
+	err := s.Teams.Create(context.Background(), &store.Team{
+		TeamID:  "team-1",
+		Name:    "Team",
+		Admins:  []string{"alice"},
+		Members: []string{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func createTask(t *testing.T, task Task) rest.Response {
+	t.Helper()
+	body, _ := json.Marshal(task)
+	resp, err := Handler(context.Background(), rest.Request{
+		Method:   "POST",
+		Resource: "/tasks/create",
+		Body:     string(body),
+		Session:  &auth.Session{Username: "alice"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestTeamSettingsEnforced(t *testing.T) {
+	db := setup(t)
+
+	weekend := Task{Title: "Backup", TeamID: "team-1", Schedule: &WeeklySchedule{
+		Saturday: &TimeSlot{BeginTime: "07:00", EndTime: "08:00"},
+	}}
+
+	// Teams that never saved settings aren't held to the defaults
+	if resp := createTask(t, weekend); resp.StatusCode != 201 {
+		t.Fatalf("task of a team without settings: got %d %s, want 201", resp.StatusCode, resp.Body)
+	}
+
+	settings := teams.DefaultSettings()
+	settings.AllowedTaskTypes = []string{"meeting", "review"}
+	if err := teams.SaveSettings(context.Background(), db, "team-1", settings); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		task Task
+		want int
+		// message is part of the error returned for rejected tasks
+		message string
+	}{
+		{"non-working day", weekend, 400, "not a working day"},
+		{"outside working hours", Task{TeamID: "team-1", TaskType: "meeting", Schedule: &WeeklySchedule{
+			Monday: &TimeSlot{BeginTime: "16:30", EndTime: "17:30"},
+		}}, 400, "outside working hours"},
+		{"task type not allowed", Task{TeamID: "team-1", TaskType: "chore", Schedule: &WeeklySchedule{
+			Monday: &TimeSlot{BeginTime: "10:00", EndTime: "11:00"},
+		}}, 400, "not allowed"},
+		{"defaults filled in", Task{TeamID: "team-1", Schedule: &WeeklySchedule{
+			Monday: &TimeSlot{BeginTime: "16:30"},
+		}}, 201, ""},
+	}
+	for _, test := range tests {
+		resp := createTask(t, test.task)
+		if resp.StatusCode != test.want || !strings.Contains(resp.Body, test.message) {
+			t.Errorf("%s: got %d %s, want %d %q", test.name, resp.StatusCode, resp.Body, test.want, test.message)
+		}
+	}
+}
+
+func TestCreateTaskUnknownTeam(t *testing.T) {
+	setup(t)
+	body, _ := json.Marshal(Task{Title: "Backup", TeamID: "no-such-team"})
+	resp, err := Handler(context.Background(), rest.Request{
+		Method:   "POST",
+		Resource: "/tasks/create",
+		Body:     string(body),
+		Session:  &auth.Session{Username: "root", UserType: auth.UserTypeSuperadmin},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 404 {
+		t.Errorf("task of an unknown team: got %d %s, want 404", resp.StatusCode, resp.Body)
+	}
+}
+
+func TestApplyTeamSettingsWeekStart(t *testing.T) {
+	settings := teams.DefaultSettings()
+	settings.WeekStart = "sunday"
+	task := Task{Schedule: &WeeklySchedule{
+		Sunday:   &TimeSlot{BeginTime: "10:00", EndTime: "11:00"},
+		Saturday: &TimeSlot{BeginTime: "10:00", EndTime: "11:00"},
+	}}
+
+	err := applyTeamSettings(&task, settings, true, time.Now())
+	if err == nil || !strings.Contains(err.Error(), "sunday") {
+		t.Errorf("got error %v, want one about sunday, the first day of the team's week", err)
+	}
+}
+
+func TestApplyTeamSettingsTimeZone(t *testing.T) {
+	settings := teams.DefaultSettings()
+	settings.TimeZone = "America/New_York"
+	// A Monday in summer time: New York is UTC-4 and Paris UTC+2
+	now := time.Date(2026, 7, 6, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		timeZone   string
+		begin, end string
+		wantErr    bool
+	}{
+		{"America/New_York", "09:00", "10:00", false},
+		// 09:00-10:00 in New York
+		{"Europe/Paris", "15:00", "16:00", false},
+		// 03:00-04:00 in New York, which compared as is would pass
+		{"Europe/Paris", "09:00", "10:00", true},
+		// Sunday evening in New York
+		{"Asia/Tokyo", "08:00", "09:00", true},
+	}
+	for _, test := range tests {
+		task := Task{TimeZone: test.timeZone, Schedule: &WeeklySchedule{
+			Monday: &TimeSlot{BeginTime: test.begin, EndTime: test.end},
+		}}
+		err := applyTeamSettings(&task, settings, true, now)
+		if (err != nil) != test.wantErr {
+			t.Errorf("monday %s-%s in %s: got error %v, want error %v", test.begin, test.end, test.timeZone, err, test.wantErr)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+// Package team serves POST /teams/create.
+package team
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"agendum/internal/api/rest"
+	"agendum/internal/store"
+	"agendum/pkg/utils"
+)
+
+var db *store.Store
+
+// SetStore sets the store the handlers read and write
+func SetStore(s *store.Store) {
+	db = s
+}
+
+type Team struct {
+	Name    string   `json:"name"`
+	Admins  []string `json:"admins"`
+	Members []string `json:"members"`
+}
+
+// Handler serves POST /teams/create, its only route: it creates a team with
+// the admins and members listed in the request, who need not include the
+// caller, and adds the team to each of their user records
+func Handler(ctx context.Context, request rest.Request) (rest.Response, error) {
+	// The authorizer has already validated the token
+	_, valid := request.Authenticated()
+	if !valid {
+		return rest.Response{
+			StatusCode: 401,
+			Headers: map[string]string{
+				"Content-Type":                 "application/json",
+				"Access-Control-Allow-Origin":  "*",
+				"Access-Control-Allow-Headers": "Content-Type,X-Amz-Date,Authorization,X-Api-Key,X-Amz-Security-Token",
+				"Access-Control-Allow-Methods": "POST,OPTIONS",
+			},
+			Body: `{"message":"Invalid or expired token"}`,
+		}, nil
+	}
+
+	var team Team
+	if err := json.Unmarshal([]byte(request.Body), &team); err != nil {
+		return rest.Response{StatusCode: 400}, err
+	}
+
+	teamID := utils.GenerateID()
+	createdTimestamp := time.Now().Format(time.RFC3339)
+
+	err := db.Teams.Create(ctx, &store.Team{
+		TeamID:           teamID,
+		Name:             team.Name,
+		CreatedTimestamp: createdTimestamp,
+		Admins:           team.Admins,
+		Members:          team.Members,
+	})
+
+	if err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+
+	// Update user records to include this team ID
+	allUsers := append(team.Admins, team.Members...)
+	for _, username := range allUsers {
+		if err := db.Users.AddTeam(ctx, username, teamID); err != nil {
+			// Continue even if user update fails
+			continue
+		}
+	}
+
+	return rest.Response{
+		StatusCode: 201,
+		Headers: map[string]string{
+			"Content-Type":                 "application/json",
+			"Access-Control-Allow-Origin":  "*",
+			"Access-Control-Allow-Headers": "Content-Type,X-Amz-Date,Authorization,X-Api-Key,X-Amz-Security-Token",
+			"Access-Control-Allow-Methods": "POST,OPTIONS",
+		},
+		Body: `{"message":"Team created successfully","team_id":"` + teamID + `"}`,
+	}, nil
+}
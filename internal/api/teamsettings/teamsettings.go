@@ -0,0 +1,111 @@
+// Package teamsettings serves the /teams/{team_id}/settings routes.
+package teamsettings
+
+import (
+	"context"
+	"encoding/json"
+
+	"agendum/internal/api/rest"
+	"agendum/internal/store"
+	"agendum/pkg/teams"
+)
+
+var db *store.Store
+
+// SetStore sets the store the handlers read and write
+func SetStore(s *store.Store) {
+	db = s
+}
+
+func response(statusCode int, body string) rest.Response {
+	return rest.Response{
+		StatusCode: statusCode,
+		Headers: map[string]string{
+			"Content-Type":                 "application/json",
+			"Access-Control-Allow-Origin":  "*",
+			"Access-Control-Allow-Headers": "Content-Type,X-Amz-Date,Authorization,X-Api-Key,X-Amz-Security-Token",
+			"Access-Control-Allow-Methods": "GET,PUT,OPTIONS",
+		},
+		Body: body,
+	}
+}
+
+func errorResponse(statusCode int, message string) rest.Response {
+	body, _ := json.Marshal(map[string]string{"message": message})
+	return response(statusCode, string(body))
+}
+
+// Handler reads or updates a team's settings
+func Handler(ctx context.Context, request rest.Request) (rest.Response, error) {
+	// The authorizer has already validated the token
+	current, valid := request.Authenticated()
+	if !valid {
+		return errorResponse(401, "Invalid or expired token"), nil
+	}
+
+	teamID := request.PathParams["team_id"]
+
+	switch request.Method {
+	case "GET":
+		if !current.IsTeamMember(ctx, db, teamID) {
+			return errorResponse(403, "Only team members can view team settings"), nil
+		}
+		return getSettings(ctx, teamID)
+	case "PUT":
+		if !current.IsTeamAdmin(ctx, db, teamID) {
+			return errorResponse(403, "Only team admins can update team settings"), nil
+		}
+		return updateSettings(ctx, teamID, request.Body)
+	default:
+		return errorResponse(405, "Method not allowed"), nil
+	}
+}
+
+func getSettings(ctx context.Context, teamID string) (rest.Response, error) {
+	settings, _, err := teams.GetSettings(ctx, db, teamID)
+	if err == teams.ErrTeamNotFound {
+		return errorResponse(404, "Team not found"), nil
+	}
+	if err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+
+	body, _ := json.Marshal(settings)
+	return response(200, string(body)), nil
+}
+
+// updateSettings applies the request body on top of the current settings, so
+// callers only need to send the fields they change. A working day set to null
+// becomes a non-working day.
+func updateSettings(ctx context.Context, teamID, requestBody string) (rest.Response, error) {
+	settings, _, err := teams.GetSettings(ctx, db, teamID)
+	if err == teams.ErrTeamNotFound {
+		return errorResponse(404, "Team not found"), nil
+	}
+	if err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+
+	if err := json.Unmarshal([]byte(requestBody), settings); err != nil {
+		return errorResponse(400, "Invalid JSON"), nil
+	}
+
+	for day, slot := range settings.WorkingHours {
+		if slot == nil {
+			delete(settings.WorkingHours, day)
+		}
+	}
+
+	if err := settings.Validate(); err != nil {
+		return errorResponse(400, err.Error()), nil
+	}
+
+	if err := teams.SaveSettings(ctx, db, teamID, settings); err == teams.ErrTeamNotFound {
+		return errorResponse(404, "Team not found"), nil
+	} else if err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+
+	body, _ := json.Marshal(settings)
+	return response(200, string(body)), nil
+}
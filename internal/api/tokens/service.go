@@ -0,0 +1,89 @@
+package tokens
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"agendum/internal/api/rest"
+	"agendum/internal/store"
+	"agendum/pkg/auth"
+)
+
+type ServiceAccount struct {
+	Username    string `json:"username"`
+	FirstName   string `json:"firstName"`
+	LastName    string `json:"lastName"`
+	OwnerTeamID string `json:"owner_team_id"`
+	// Role is the account's role in its owner team, "member" (default) or
+	// "admin"; admin is needed to create tasks
+	Role string `json:"role"`
+}
+
+func getServiceAccount(ctx context.Context, username string) (*ServiceAccount, error) {
+	user, err := db.Users.Get(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || user.UserType != auth.UserTypeService {
+		return nil, nil
+	}
+
+	return &ServiceAccount{
+		Username:    username,
+		OwnerTeamID: user.OwnerTeamID,
+	}, nil
+}
+
+// createServiceAccount adds a service account to a team the caller
+// administers. The team owns it: its admins manage the account's tokens.
+// Service accounts have no email or password, so they can't log in and only
+// act through access tokens.
+func createServiceAccount(ctx context.Context, current *auth.Session, teamID, body string) (rest.Response, error) {
+	if !current.IsTeamAdmin(ctx, db, teamID) {
+		return errorResponse(403, "Only team admins can create service accounts"), nil
+	}
+
+	var account ServiceAccount
+	if err := json.Unmarshal([]byte(body), &account); err != nil {
+		return errorResponse(400, "Invalid request body"), nil
+	}
+	account.Username = strings.TrimSpace(account.Username)
+	if account.Username == "" || strings.Contains(account.Username, ",") {
+		return errorResponse(400, "username is required and can't contain commas"), nil
+	}
+	if account.Role == "" {
+		account.Role = "member"
+	}
+	if account.Role != "member" && account.Role != "admin" {
+		return errorResponse(400, `role must be "member" or "admin"`), nil
+	}
+	account.OwnerTeamID = teamID
+
+	// The account goes on the team's roster in the same step, which fails
+	// rather than overwrite a concurrent change to the roster
+	err := db.Users.CreateServiceAccount(ctx, &store.User{
+		Username:    account.Username,
+		FirstName:   account.FirstName,
+		LastName:    account.LastName,
+		UserType:    auth.UserTypeService,
+		TeamIDs:     []string{teamID},
+		OwnerTeamID: teamID,
+		CreatedBy:   current.Username,
+	}, account.Role)
+	if err == store.ErrNotFound {
+		return errorResponse(404, "Team not found"), nil
+	}
+	if err == store.ErrUsernameTaken {
+		return errorResponse(409, "Username is already taken"), nil
+	}
+	if err == store.ErrConflict {
+		return errorResponse(409, "The team changed while adding the account, try again"), nil
+	}
+	if err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+
+	responseBody, _ := json.Marshal(account)
+	return response(201, string(responseBody)), nil
+}
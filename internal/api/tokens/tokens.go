@@ -0,0 +1,197 @@
+// Package tokens serves personal access tokens and team service accounts.
+package tokens
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"agendum/internal/api/rest"
+	"agendum/internal/store"
+	"agendum/pkg/auth"
+)
+
+const (
+	defaultTokenDays = 90
+	maxTokenDays     = 365
+)
+
+var db *store.Store
+
+// SetStore sets the store the handlers read and write
+func SetStore(s *store.Store) {
+	db = s
+}
+
+type CreateTokenRequest struct {
+	// Username is a service account to create the token for; empty means
+	// the caller
+	Username      string   `json:"username"`
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days"`
+}
+
+type CreateTokenResponse struct {
+	Message string `json:"message"`
+	Token   string `json:"token"`
+	*auth.AccessToken
+}
+
+func response(statusCode int, body string) rest.Response {
+	return rest.Response{
+		StatusCode: statusCode,
+		Headers: map[string]string{
+			"Content-Type":                 "application/json",
+			"Access-Control-Allow-Origin":  "*",
+			"Access-Control-Allow-Headers": "Content-Type,X-Amz-Date,Authorization,X-Api-Key,X-Amz-Security-Token",
+			"Access-Control-Allow-Methods": "GET,POST,DELETE,OPTIONS",
+		},
+		Body: body,
+	}
+}
+
+func errorResponse(statusCode int, message string) rest.Response {
+	body, _ := json.Marshal(map[string]string{"message": message})
+	return response(statusCode, string(body))
+}
+
+// Handler serves the /tokens and /teams/{team_id}/service-accounts routes
+func Handler(ctx context.Context, request rest.Request) (rest.Response, error) {
+	current, valid := request.Authenticated()
+	if !valid {
+		return errorResponse(401, "Invalid or expired token"), nil
+	}
+	// Tokens can't mint more tokens; only someone who logged in can
+	if current.Scopes != nil {
+		return errorResponse(403, "Personal access tokens can't manage tokens or service accounts"), nil
+	}
+
+	switch request.Method + " " + request.Resource {
+	case "POST /tokens":
+		return createToken(ctx, current, request.Body)
+	case "GET /tokens":
+		return listTokens(ctx, current, request.Query["username"])
+	case "DELETE /tokens/{token_id}":
+		return revokeToken(ctx, current, request.Query["username"], request.PathParams["token_id"])
+	case "POST /teams/{team_id}/service-accounts":
+		return createServiceAccount(ctx, current, request.PathParams["team_id"], request.Body)
+	}
+
+	return errorResponse(404, "Not found"), nil
+}
+
+// tokenOwner works out whose tokens the caller is managing: their own, or
+// those of a service account owned by a team they administer
+func tokenOwner(ctx context.Context, current *auth.Session, username string) (string, *rest.Response, error) {
+	if username == "" || username == current.Username {
+		return current.Username, nil, nil
+	}
+
+	account, err := getServiceAccount(ctx, username)
+	if err != nil {
+		return "", nil, err
+	}
+	if account == nil || !current.IsTeamAdmin(ctx, db, account.OwnerTeamID) {
+		denied := errorResponse(403, "You can only manage tokens of service accounts owned by teams you administer")
+		return "", &denied, nil
+	}
+	return username, nil, nil
+}
+
+func createToken(ctx context.Context, current *auth.Session, body string) (rest.Response, error) {
+	var req CreateTokenRequest
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		return errorResponse(400, "Invalid request body"), nil
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 100 {
+		return errorResponse(400, "name is required and must be at most 100 characters"), nil
+	}
+	if len(req.Scopes) == 0 {
+		return errorResponse(400, "scopes must list at least one of: "+strings.Join(auth.Scopes, ", ")), nil
+	}
+	for _, scope := range req.Scopes {
+		if !auth.ValidScope(scope) {
+			return errorResponse(400, "unknown scope "+scope+", expected one of: "+strings.Join(auth.Scopes, ", ")), nil
+		}
+	}
+	if req.ExpiresInDays == 0 {
+		req.ExpiresInDays = defaultTokenDays
+	}
+	if req.ExpiresInDays < 1 || req.ExpiresInDays > maxTokenDays {
+		return errorResponse(400, "expires_in_days must be between 1 and 365"), nil
+	}
+
+	owner, denied, err := tokenOwner(ctx, current, req.Username)
+	if err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+	if denied != nil {
+		return *denied, nil
+	}
+
+	token, record, err := auth.IssueAccessToken(ctx, db, owner, req.Name, dedupe(req.Scopes), time.Duration(req.ExpiresInDays)*24*time.Hour, current.Username)
+	if err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+
+	responseBody, _ := json.Marshal(CreateTokenResponse{
+		Message:     "Token created. Copy it now, it won't be shown again.",
+		Token:       token,
+		AccessToken: record,
+	})
+	return response(201, string(responseBody)), nil
+}
+
+func listTokens(ctx context.Context, current *auth.Session, username string) (rest.Response, error) {
+	owner, denied, err := tokenOwner(ctx, current, username)
+	if err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+	if denied != nil {
+		return *denied, nil
+	}
+
+	tokens, err := auth.ListAccessTokens(ctx, db, owner)
+	if err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+
+	body, _ := json.Marshal(tokens)
+	return response(200, string(body)), nil
+}
+
+func revokeToken(ctx context.Context, current *auth.Session, username, tokenID string) (rest.Response, error) {
+	owner, denied, err := tokenOwner(ctx, current, username)
+	if err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+	if denied != nil {
+		return *denied, nil
+	}
+
+	found, err := auth.RevokeAccessToken(ctx, db, owner, tokenID)
+	if err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+	if !found {
+		return errorResponse(404, "Token not found"), nil
+	}
+
+	return errorResponse(200, "Token revoked"), nil
+}
+
+func dedupe(values []string) []string {
+	seen := make(map[string]bool)
+	var unique []string
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,227 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+
+	"agendum/internal/api/rest"
+	"agendum/internal/store"
+	"agendum/pkg/auth"
+)
+
+const (
+	maxPreferences        = 50
+	maxPreferenceKeyLen   = 64
+	maxPreferenceValueLen = 1024
+)
+
+// Profile is what a user sees about themselves; it never includes the password hash
+type Profile struct {
+	Username      string            `json:"username"`
+	Email         string            `json:"email"`
+	EmailVerified bool              `json:"emailVerified"`
+	FirstName     string            `json:"firstName"`
+	LastName      string            `json:"lastName"`
+	UserType      string            `json:"userType"`
+	TeamIDs       []string          `json:"teamIds"`
+	Preferences   map[string]string `json:"preferences"`
+}
+
+// PublicProfile is what any authenticated user can see about another user
+type PublicProfile struct {
+	Username  string `json:"username"`
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+}
+
+// ProfileUpdate holds the fields PATCH /users/me may change. A preference set
+// to null is removed.
+type ProfileUpdate struct {
+	FirstName   *string            `json:"firstName"`
+	LastName    *string            `json:"lastName"`
+	Preferences map[string]*string `json:"preferences"`
+}
+
+func response(statusCode int, body string) rest.Response {
+	return rest.Response{
+		StatusCode: statusCode,
+		Headers: map[string]string{
+			"Content-Type":                 "application/json",
+			"Access-Control-Allow-Origin":  "*",
+			"Access-Control-Allow-Headers": "Content-Type,X-Amz-Date,Authorization,X-Api-Key,X-Amz-Security-Token",
+			"Access-Control-Allow-Methods": "GET,POST,PUT,PATCH,DELETE,OPTIONS",
+		},
+		Body: body,
+	}
+}
+
+func errorResponse(statusCode int, message string) rest.Response {
+	body, _ := json.Marshal(map[string]string{"message": message})
+	return response(statusCode, string(body))
+}
+
+// authenticate returns the user the authorizer validated the request's
+// token for
+func authenticate(request rest.Request) (string, bool) {
+	current, valid := request.Authenticated()
+	if !valid {
+		return "", false
+	}
+	return current.Username, true
+}
+
+func profileFromUser(user *store.User) Profile {
+	profile := Profile{
+		Username:      user.Username,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		FirstName:     user.FirstName,
+		LastName:      user.LastName,
+		UserType:      auth.NormalizeUserType(user.UserType),
+		TeamIDs:       append([]string{}, user.TeamIDs...),
+		Preferences:   map[string]string{},
+	}
+	for key, value := range user.Preferences {
+		profile.Preferences[key] = value
+	}
+	return profile
+}
+
+func getProfile(ctx context.Context, username string) (rest.Response, error) {
+	user, err := db.Users.Get(ctx, username)
+	if err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+	if user == nil {
+		return errorResponse(404, "User not found"), nil
+	}
+
+	body, _ := json.Marshal(profileFromUser(user))
+	return response(200, string(body)), nil
+}
+
+func getPublicProfile(ctx context.Context, username string) (rest.Response, error) {
+	user, err := db.Users.Get(ctx, username)
+	if err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+	if user == nil {
+		return errorResponse(404, "User not found"), nil
+	}
+
+	body, _ := json.Marshal(PublicProfile{
+		Username:  user.Username,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+	})
+	return response(200, string(body)), nil
+}
+
+func updateProfile(ctx context.Context, username, requestBody string) (rest.Response, error) {
+	var update ProfileUpdate
+	if err := json.Unmarshal([]byte(requestBody), &update); err != nil {
+		return errorResponse(400, "Invalid JSON"), nil
+	}
+
+	user, err := db.Users.Get(ctx, username)
+	if err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+	if user == nil {
+		return errorResponse(404, "User not found"), nil
+	}
+
+	profile := profileFromUser(user)
+	if update.FirstName != nil {
+		profile.FirstName = *update.FirstName
+	}
+	if update.LastName != nil {
+		profile.LastName = *update.LastName
+	}
+	for key, value := range update.Preferences {
+		if value == nil {
+			delete(profile.Preferences, key)
+			continue
+		}
+		if key == "" || len(key) > maxPreferenceKeyLen || len(*value) > maxPreferenceValueLen {
+			return errorResponse(400, "Preference keys must be 1-64 characters and values at most 1024 characters"), nil
+		}
+		profile.Preferences[key] = *value
+	}
+	if len(profile.Preferences) > maxPreferences {
+		return errorResponse(400, "At most 50 preferences can be stored"), nil
+	}
+
+	err = db.Users.UpdateProfile(ctx, username, profile.FirstName, profile.LastName, profile.Preferences)
+	if err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+
+	body, _ := json.Marshal(profile)
+	return response(200, string(body)), nil
+}
+
+// deleteUser removes the user from their teams, promoting another member of
+// the teams they were the last admin of, hands the tasks they requested to
+// another admin of the task's team (or deletes them when no one is left in
+// the team), deletes the user and finally revokes their sessions
+func deleteUser(ctx context.Context, username string) (rest.Response, error) {
+	user, err := db.Users.Get(ctx, username)
+	if err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+	if user == nil {
+		return errorResponse(404, "User not found"), nil
+	}
+
+	remainingAdmins := make(map[string][]string)
+	for _, teamID := range user.TeamIDs {
+		admins, err := db.Teams.RemoveUser(ctx, teamID, username)
+		if err == store.ErrConflict {
+			return errorResponse(409, "A team kept changing while removing the user, try again"), nil
+		}
+		if err != nil {
+			return rest.Response{StatusCode: 500}, err
+		}
+		remainingAdmins[teamID] = admins
+	}
+
+	if err := reassignTasks(ctx, username, remainingAdmins); err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+
+	// Also releases the email so it can be used to sign up again
+	if err := db.Users.Delete(ctx, username); err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+
+	if err := auth.RevokeUserSessions(ctx, db, username); err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+	if err := auth.RevokeUserAccessTokens(ctx, db, username); err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+
+	return response(200, `{"message":"User deleted successfully"}`), nil
+}
+
+func reassignTasks(ctx context.Context, username string, remainingAdmins map[string][]string) error {
+	tasks, err := db.Tasks.ListByRequester(ctx, username)
+	if err != nil {
+		return err
+	}
+
+	for _, task := range tasks {
+		admins := remainingAdmins[task.TeamID]
+		if len(admins) == 0 {
+			err = db.Tasks.Delete(ctx, task.TaskID)
+		} else {
+			err = db.Tasks.SetRequester(ctx, task.TaskID, admins[0])
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,146 @@
+// Package user serves the /users routes: signup, email verification,
+// profiles and platform roles.
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"agendum/internal/api/rest"
+	"agendum/internal/store"
+	"agendum/pkg/auth"
+	"agendum/pkg/password"
+	"agendum/pkg/utils"
+)
+
+var db *store.Store
+
+// SetStore sets the store the handlers read and write
+func SetStore(s *store.Store) {
+	db = s
+}
+
+type User struct {
+	Username  string   `json:"username"`
+	Email     string   `json:"email"`
+	Password  string   `json:"password"`
+	FirstName string   `json:"firstName"`
+	LastName  string   `json:"lastName"`
+	UserType  string   `json:"userType"`
+	TeamIDs   []string `json:"teamIds"`
+}
+
+// Handler serves every /users route
+func Handler(ctx context.Context, request rest.Request) (rest.Response, error) {
+	switch request.Resource {
+	case "/users/create":
+		return createUser(ctx, request)
+	case "/users/me":
+		username, valid := authenticate(request)
+		if !valid {
+			return errorResponse(401, "Invalid or expired token"), nil
+		}
+		switch request.Method {
+		case "GET":
+			return getProfile(ctx, username)
+		case "PATCH":
+			return updateProfile(ctx, username, request.Body)
+		case "DELETE":
+			return deleteUser(ctx, username)
+		}
+		return errorResponse(405, "Method not allowed"), nil
+	case "/users/verify":
+		return verifyEmail(ctx, request.Body)
+	case "/users/verify/resend":
+		return resendVerification(ctx, request.Body)
+	case "/users/{username}/type":
+		current, valid := request.Authenticated()
+		if !valid {
+			return errorResponse(401, "Invalid or expired token"), nil
+		}
+		return setUserType(ctx, current, request.PathParams["username"], request.Body)
+	case "/users/{username}":
+		if _, valid := authenticate(request); !valid {
+			return errorResponse(401, "Invalid or expired token"), nil
+		}
+		return getPublicProfile(ctx, request.PathParams["username"])
+	}
+
+	return errorResponse(404, "Not found"), nil
+}
+
+func createUser(ctx context.Context, request rest.Request) (rest.Response, error) {
+	var user User
+	if err := json.Unmarshal([]byte(request.Body), &user); err != nil {
+		return rest.Response{StatusCode: 400}, err
+	}
+
+	if user.Username == "" || utils.NormalizeEmail(user.Email) == "" {
+		return errorResponse(400, "username and email are required"), nil
+	}
+
+	// Everyone signs up as a standard user. Privileged types are granted by a
+	// superadmin through /users/{username}/type, and service accounts are
+	// created by team admins through /teams/{team_id}/service-accounts.
+	if user.UserType == "" {
+		user.UserType = auth.UserTypeStandard
+	}
+	if user.UserType != auth.UserTypeStandard {
+		return errorResponse(403, "Only standard accounts can be created by signing up"), nil
+	}
+
+	if err := password.PolicyFromEnv().Check(user.Password, user.Username, user.Email); err != nil {
+		body, _ := json.Marshal(err)
+		return response(400, string(body)), nil
+	}
+
+	// Hash password
+	hashedPassword, err := password.Hash(user.Password)
+	if err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+
+	now := time.Now().Unix()
+	err = db.Users.Create(ctx, &store.User{
+		Username:  user.Username,
+		Email:     utils.NormalizeEmail(user.Email),
+		Password:  hashedPassword,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		UserType:  user.UserType,
+		TeamIDs:   []string{},
+		// Unverified until the link sent below is opened
+		EmailVerified:           false,
+		VerificationSentAt:      now,
+		VerificationWindowStart: now,
+		VerificationSends:       1,
+	})
+	if err == store.ErrUsernameTaken {
+		return errorResponse(409, "Username is already taken"), nil
+	}
+	if err == store.ErrEmailTaken {
+		return errorResponse(409, "An account with this email already exists"), nil
+	}
+	if err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+
+	// The account exists either way; a failed send can be retried through
+	// /users/verify/resend
+	if err := sendVerification(ctx, user.Username, utils.NormalizeEmail(user.Email)); err != nil {
+		log.Printf("sending verification email to %s: %v", user.Username, err)
+	}
+
+	return rest.Response{
+		StatusCode: 201,
+		Headers: map[string]string{
+			"Content-Type":                 "application/json",
+			"Access-Control-Allow-Origin":  "*",
+			"Access-Control-Allow-Headers": "Content-Type,X-Amz-Date,Authorization,X-Api-Key,X-Amz-Security-Token",
+			"Access-Control-Allow-Methods": "POST,OPTIONS",
+		},
+		Body: `{"message":"User created successfully. Check your email to verify your address."}`,
+	}, nil
+}
@@ -0,0 +1,69 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"agendum/internal/api/rest"
+	"agendum/internal/store/memory"
+	"agendum/pkg/auth"
+	"agendum/pkg/password"
+)
+
+func signup(t *testing.T, user User) rest.Response {
+	t.Helper()
+	body, _ := json.Marshal(user)
+	resp, err := Handler(context.Background(), rest.Request{
+		Method:   "POST",
+		Resource: "/users/create",
+		Body:     string(body),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestCreateUser(t *testing.T) {
+	t.Setenv("VERIFICATION_SIGNING_KEY", strings.Repeat("k", 32))
+	db := memory.New()
+	SetStore(db)
+
+	resp := signup(t, User{Username: "alice", Email: " Alice@Example.com", Password: "correct-horse-battery"})
+	if resp.StatusCode != 201 {
+		t.Fatalf("signup: got %d %s", resp.StatusCode, resp.Body)
+	}
+
+	stored, err := db.Users.Get(context.Background(), "alice")
+	if err != nil || stored == nil {
+		t.Fatalf("user wasn't stored: %v", err)
+	}
+	if stored.Email != "alice@example.com" {
+		t.Errorf("email stored as %q, want it normalized", stored.Email)
+	}
+	if stored.UserType != auth.UserTypeStandard || stored.EmailVerified {
+		t.Errorf("got type %q, verified %v; want an unverified standard user", stored.UserType, stored.EmailVerified)
+	}
+	if matched, _, _ := password.Verify("correct-horse-battery", stored.Password); !matched {
+		t.Error("stored password hash doesn't match the password")
+	}
+
+	tests := []struct {
+		name string
+		user User
+		want int
+	}{
+		{"username taken", User{Username: "alice", Email: "other@example.com", Password: "correct-horse-battery"}, 409},
+		{"email taken", User{Username: "bob", Email: "ALICE@example.com", Password: "correct-horse-battery"}, 409},
+		{"privileged type", User{Username: "bob", Email: "bob@example.com", Password: "correct-horse-battery", UserType: auth.UserTypeSuperadmin}, 403},
+		{"password contains username", User{Username: "bobby", Email: "bob@example.com", Password: "bobby-horse-battery"}, 400},
+		{"missing email", User{Username: "bob", Password: "correct-horse-battery"}, 400},
+	}
+	for _, test := range tests {
+		if resp := signup(t, test.user); resp.StatusCode != test.want {
+			t.Errorf("%s: got %d %s, want %d", test.name, resp.StatusCode, resp.Body, test.want)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+
+	"agendum/internal/api/rest"
+	"agendum/internal/store"
+	"agendum/pkg/auth"
+)
+
+type UserTypeUpdate struct {
+	UserType string `json:"userType"`
+}
+
+// setUserType changes a user's platform role. Only superadmins may do it,
+// and not for themselves, so there is always one left to undo a mistake.
+func setUserType(ctx context.Context, current *auth.Session, username, body string) (rest.Response, error) {
+	if !current.IsSuperadmin() {
+		return errorResponse(403, "Only superadmins can change user types"), nil
+	}
+	if username == current.Username {
+		return errorResponse(403, "Superadmins can't change their own type"), nil
+	}
+
+	var update UserTypeUpdate
+	if err := json.Unmarshal([]byte(body), &update); err != nil {
+		return errorResponse(400, "Invalid request body"), nil
+	}
+	if !auth.ValidUserType(update.UserType) || update.UserType == auth.UserTypeService {
+		return errorResponse(400, `userType must be "superadmin", "staff" or "standard"`), nil
+	}
+
+	// Service accounts stay service accounts; they belong to their team
+	err := db.Users.SetUserType(ctx, username, update.UserType)
+	if err == store.ErrNotFound {
+		return errorResponse(404, "User not found or is a service account"), nil
+	}
+	if err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+
+	responseBody, _ := json.Marshal(map[string]string{
+		"username": username,
+		"userType": update.UserType,
+	})
+	return response(200, string(responseBody)), nil
+}
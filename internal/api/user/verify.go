@@ -0,0 +1,145 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strconv"
+	"time"
+
+	"agendum/internal/api/rest"
+	"agendum/internal/store"
+	"agendum/pkg/auth"
+	"agendum/pkg/mail"
+	"agendum/pkg/utils"
+)
+
+// A user can have a verification email resent once per resendInterval and
+// at most maxResends times per resendWindow
+const (
+	resendInterval = time.Minute
+	resendWindow   = 24 * time.Hour
+	maxResends     = 5
+)
+
+type VerifyRequest struct {
+	Token string `json:"token"`
+}
+
+type ResendRequest struct {
+	Email string `json:"email"`
+}
+
+// sendVerification emails a signed link that verifies the user's address
+func sendVerification(ctx context.Context, username, email string) error {
+	token, err := auth.SignEmailVerification(username, email)
+	if err != nil {
+		return err
+	}
+
+	sender, err := mail.NewSender()
+	if err != nil {
+		return err
+	}
+
+	return sender.Send(ctx, mail.Message{
+		To:      email,
+		Subject: "Verify your Agendum email address",
+		Body: "Welcome to Agendum, " + username + ".\n\n" +
+			"Open this link within the next 48 hours to verify your email address:\n" +
+			os.Getenv("APP_BASE_URL") + "/verify-email?token=" + token + "\n\n" +
+			"If you didn't sign up, ignore this email.",
+	})
+}
+
+// verifyEmail marks the user's email verified if the link's token vouches for
+// the address the account still has
+func verifyEmail(ctx context.Context, body string) (rest.Response, error) {
+	var req VerifyRequest
+	if err := json.Unmarshal([]byte(body), &req); err != nil || req.Token == "" {
+		return errorResponse(400, "token is required"), nil
+	}
+
+	username, email, err := auth.ParseEmailVerification(req.Token)
+	if err == auth.ErrVerificationInvalid {
+		return errorResponse(400, "Invalid or expired verification link"), nil
+	}
+	if err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+
+	err = db.Users.MarkEmailVerified(ctx, username, email)
+	if err == store.ErrConflict {
+		return errorResponse(400, "Invalid or expired verification link"), nil
+	}
+	if err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+
+	return errorResponse(200, "Email verified"), nil
+}
+
+// resendVerification sends another verification email. Signing up already
+// tells whether an email has an account, so unlike password resets this
+// reports rate limiting instead of hiding it.
+func resendVerification(ctx context.Context, body string) (rest.Response, error) {
+	var req ResendRequest
+	if err := json.Unmarshal([]byte(body), &req); err != nil || utils.NormalizeEmail(req.Email) == "" {
+		return errorResponse(400, "email is required"), nil
+	}
+
+	sent := errorResponse(202, "If this email has an unverified account, a verification link has been sent")
+
+	username, err := db.Users.EmailOwner(ctx, utils.NormalizeEmail(req.Email))
+	if err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+	if username == "" {
+		return sent, nil
+	}
+
+	user, err := db.Users.Get(ctx, username)
+	if err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+	if user == nil || user.EmailVerified {
+		return sent, nil
+	}
+
+	now := time.Now()
+	lastSent := user.VerificationSentAt
+	windowStart := user.VerificationWindowStart
+	sends := user.VerificationSends
+
+	if wait := time.Unix(lastSent, 0).Add(resendInterval).Sub(now); wait > 0 {
+		return rateLimited(wait), nil
+	}
+	if now.Sub(time.Unix(windowStart, 0)) >= resendWindow {
+		windowStart, sends = now.Unix(), 0
+	}
+	if sends >= maxResends {
+		return rateLimited(time.Unix(windowStart, 0).Add(resendWindow).Sub(now)), nil
+	}
+
+	// Conditioned on the previous send time so concurrent requests can't
+	// both get through
+	err = db.Users.RecordVerificationSent(ctx, username, lastSent, now.Unix(), windowStart, sends+1)
+	if err == store.ErrConflict {
+		return rateLimited(resendInterval), nil
+	}
+	if err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+
+	if err := sendVerification(ctx, username, user.Email); err != nil {
+		return rest.Response{StatusCode: 500}, err
+	}
+
+	return sent, nil
+}
+
+func rateLimited(wait time.Duration) rest.Response {
+	resp := errorResponse(429, "Too many verification emails requested, try again later")
+	resp.Headers["Retry-After"] = strconv.FormatInt(int64(wait/time.Second)+1, 10)
+	return resp
+}
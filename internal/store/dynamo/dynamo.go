@@ -0,0 +1,167 @@
+// Package dynamo implements the repositories of internal/store on the
+// DynamoDB tables defined in infrastructure/
+package dynamo
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+
+	"agendum/internal/store"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	// usersByEmailIndex is the Users table GSI keyed by email
+	usersByEmailIndex = "email-index"
+	// byUsernameIndex is the GSI keyed by username of the Sessions,
+	// RefreshTokens and AccessTokens tables
+	byUsernameIndex = "username-index"
+	// tasksByRequesterIndex is the Tasks table GSI keyed by requester
+	tasksByRequesterIndex = "requester-index"
+	// ttlAttribute is the numeric Unix-time attribute DynamoDB TTL uses to
+	// delete expired rows
+	ttlAttribute = "expires_at_epoch"
+)
+
+// Tables names the table behind each repository. The refresh token, access
+// token and revoked token tables are optional: deployments without them
+// simply have no such rows.
+type Tables struct {
+	Users         string
+	UserEmails    string
+	Teams         string
+	Tasks         string
+	Sessions      string
+	RefreshTokens string
+	AccessTokens  string
+	OneTimeTokens string
+	LoginAttempts string
+	RevokedTokens string
+}
+
+// TablesFromEnv reads the table names from the *_TABLE_NAME variables the
+// infrastructure sets on every function
+func TablesFromEnv() Tables {
+	return Tables{
+		Users:         os.Getenv("USERS_TABLE_NAME"),
+		UserEmails:    os.Getenv("EMAILS_TABLE_NAME"),
+		Teams:         os.Getenv("TEAMS_TABLE_NAME"),
+		Tasks:         os.Getenv("TASKS_TABLE_NAME"),
+		Sessions:      os.Getenv("SESSIONS_TABLE_NAME"),
+		RefreshTokens: os.Getenv("REFRESH_TOKENS_TABLE_NAME"),
+		AccessTokens:  os.Getenv("ACCESS_TOKENS_TABLE_NAME"),
+		OneTimeTokens: os.Getenv("ONE_TIME_TOKENS_TABLE_NAME"),
+		LoginAttempts: os.Getenv("LOGIN_ATTEMPTS_TABLE_NAME"),
+		RevokedTokens: os.Getenv("REVOKED_TOKENS_TABLE_NAME"),
+	}
+}
+
+type db struct {
+	svc    *dynamodb.Client
+	tables Tables
+}
+
+// New returns a store backed by the given tables. The client is meant to be
+// created once per process and shared by every call.
+func New(svc *dynamodb.Client, tables Tables) *store.Store {
+	d := &db{svc: svc, tables: tables}
+	return &store.Store{
+		Users:         users{d},
+		Teams:         teams{d},
+		Tasks:         tasks{d},
+		Sessions:      sessions{d},
+		RefreshTokens: refreshTokens{d},
+		AccessTokens:  accessTokens{d},
+		OneTimeTokens: oneTimeTokens{d},
+		LoginAttempts: loginAttempts{d},
+		RevokedTokens: revokedTokens{d},
+	}
+}
+
+// NewFromEnv returns a store on the tables named by TablesFromEnv, with a
+// client configured from the environment the way a Lambda function is. Call
+// it once per cold start, outside the handler.
+func NewFromEnv(ctx context.Context) (*store.Store, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return New(dynamodb.NewFromConfig(cfg), TablesFromEnv()), nil
+}
+
+func conditionFailed(err error) bool {
+	var failed *types.ConditionalCheckFailedException
+	return errors.As(err, &failed)
+}
+
+// onConditionFailed replaces a failed condition with a store error
+func onConditionFailed(err, replacement error) error {
+	if conditionFailed(err) {
+		return replacement
+	}
+	return err
+}
+
+// cancellationReasons returns the code of each action of a canceled
+// transaction, in the order of its items, with "None" for actions that didn't
+// fail. It returns nil when the error isn't a canceled transaction.
+func cancellationReasons(err error) []string {
+	var canceled *types.TransactionCanceledException
+	if !errors.As(err, &canceled) {
+		return nil
+	}
+	codes := make([]string, len(canceled.CancellationReasons))
+	for i, reason := range canceled.CancellationReasons {
+		if reason.Code != nil {
+			codes[i] = *reason.Code
+		}
+	}
+	return codes
+}
+
+func stringKey(name, value string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		name: &types.AttributeValueMemberS{Value: value},
+	}
+}
+
+func stringAttr(item map[string]types.AttributeValue, name string) string {
+	if attr, ok := item[name].(*types.AttributeValueMemberS); ok {
+		return attr.Value
+	}
+	return ""
+}
+
+func numberAttr(item map[string]types.AttributeValue, name string) int64 {
+	if attr, ok := item[name].(*types.AttributeValueMemberN); ok {
+		n, _ := strconv.ParseInt(attr.Value, 10, 64)
+		return n
+	}
+	return 0
+}
+
+func boolAttr(item map[string]types.AttributeValue, name string) bool {
+	attr, ok := item[name].(*types.AttributeValueMemberBOOL)
+	return ok && attr.Value
+}
+
+func number(n int64) types.AttributeValue {
+	return &types.AttributeValueMemberN{Value: strconv.FormatInt(n, 10)}
+}
+
+// splitUsers reads a team roster, which is stored as a comma-separated string
+func splitUsers(list string) []string {
+	users := []string{}
+	for _, user := range strings.Split(list, ",") {
+		if user = strings.TrimSpace(user); user != "" {
+			users = append(users, user)
+		}
+	}
+	return users
+}
@@ -0,0 +1,104 @@
+package dynamo
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// TablesForStage names the tables the way infrastructure/ does for a stage,
+// such as "beta-Users"
+func TablesForStage(stage string) Tables {
+	return Tables{
+		Users:         stage + "-Users",
+		UserEmails:    stage + "-UserEmails",
+		Teams:         stage + "-Teams",
+		Tasks:         stage + "-Tasks",
+		Sessions:      stage + "-Sessions",
+		RefreshTokens: stage + "-RefreshTokens",
+		AccessTokens:  stage + "-AccessTokens",
+		OneTimeTokens: stage + "-OneTimeTokens",
+		LoginAttempts: stage + "-LoginAttempts",
+		RevokedTokens: stage + "-RevokedTokens",
+	}
+}
+
+// tableSchema is the key and indexes of a table, as infrastructure/ creates it
+type tableSchema struct {
+	name    string
+	key     string
+	indexes []index
+}
+
+// index is a global secondary index projecting every attribute
+type index struct {
+	name string
+	key  string
+}
+
+// CreateTables creates whichever of the tables don't exist yet, for local
+// DynamoDB endpoints that weren't deployed through infrastructure/. TTLs
+// aren't enabled, so expired rows are only ignored, not deleted.
+func CreateTables(ctx context.Context, svc *dynamodb.Client, tables Tables) error {
+	byEmail := []index{{name: usersByEmailIndex, key: "email"}}
+	byUsername := []index{{name: byUsernameIndex, key: "username"}}
+	schemas := []tableSchema{
+		{name: tables.Users, key: "username", indexes: byEmail},
+		{name: tables.UserEmails, key: "email"},
+		{name: tables.Teams, key: "team_id"},
+		{name: tables.Tasks, key: "task_id", indexes: []index{{name: tasksByRequesterIndex, key: "requester"}}},
+		{name: tables.Sessions, key: "token", indexes: byUsername},
+		{name: tables.RefreshTokens, key: "token", indexes: byUsername},
+		{name: tables.AccessTokens, key: "token", indexes: byUsername},
+		{name: tables.OneTimeTokens, key: "token"},
+		{name: tables.LoginAttempts, key: "key"},
+		{name: tables.RevokedTokens, key: "key"},
+	}
+
+	for _, schema := range schemas {
+		if schema.name == "" {
+			continue
+		}
+		if err := createTable(ctx, svc, schema); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func createTable(ctx context.Context, svc *dynamodb.Client, schema tableSchema) error {
+	input := &dynamodb.CreateTableInput{
+		TableName:   aws.String(schema.name),
+		BillingMode: types.BillingModePayPerRequest,
+		AttributeDefinitions: []types.AttributeDefinition{
+			{AttributeName: aws.String(schema.key), AttributeType: types.ScalarAttributeTypeS},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: aws.String(schema.key), KeyType: types.KeyTypeHash},
+		},
+	}
+
+	for _, index := range schema.indexes {
+		input.AttributeDefinitions = append(input.AttributeDefinitions, types.AttributeDefinition{
+			AttributeName: aws.String(index.key),
+			AttributeType: types.ScalarAttributeTypeS,
+		})
+		input.GlobalSecondaryIndexes = append(input.GlobalSecondaryIndexes, types.GlobalSecondaryIndex{
+			IndexName: aws.String(index.name),
+			KeySchema: []types.KeySchemaElement{
+				{AttributeName: aws.String(index.key), KeyType: types.KeyTypeHash},
+			},
+			Projection: &types.Projection{ProjectionType: types.ProjectionTypeAll},
+		})
+	}
+
+	_, err := svc.CreateTable(ctx, input)
+	var exists *types.ResourceInUseException
+	if errors.As(err, &exists) {
+		return nil
+	}
+	return err
+}
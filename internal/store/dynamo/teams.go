@@ -0,0 +1,319 @@
+package dynamo
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"agendum/internal/store"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	// BatchGetItem accepts at most 100 keys per call
+	batchGetLimit   = 100
+	maxBatchRetries = 5
+	// RemoveUser rereads the roster and tries again this many times when it
+	// changed between reading and writing
+	maxRosterRetries = 5
+)
+
+type teams struct{ *db }
+
+func teamFromItem(item map[string]types.AttributeValue) *store.Team {
+	return &store.Team{
+		TeamID:           stringAttr(item, "team_id"),
+		Name:             stringAttr(item, "name"),
+		CreatedTimestamp: stringAttr(item, "created_timestamp"),
+		Admins:           splitUsers(stringAttr(item, "admins")),
+		Members:          splitUsers(stringAttr(item, "members")),
+	}
+}
+
+func (r teams) Get(ctx context.Context, teamID string) (*store.Team, error) {
+	result, err := r.svc.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(r.tables.Teams),
+		Key:            stringKey("team_id", teamID),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil || result.Item == nil {
+		return nil, err
+	}
+	return teamFromItem(result.Item), nil
+}
+
+// GetMany uses BatchGetItem, retrying unprocessed keys with exponential
+// backoff for as long as the context allows
+func (r teams) GetMany(ctx context.Context, teamIDs []string) (map[string]*store.Team, map[string]error) {
+	tableName := r.tables.Teams
+	found := make(map[string]*store.Team)
+	failed := make(map[string]error)
+
+	for start := 0; start < len(teamIDs); start += batchGetLimit {
+		end := start + batchGetLimit
+		if end > len(teamIDs) {
+			end = len(teamIDs)
+		}
+
+		keys := make([]map[string]types.AttributeValue, 0, end-start)
+		seen := make(map[string]bool)
+		for _, teamID := range teamIDs[start:end] {
+			if !seen[teamID] {
+				seen[teamID] = true
+				keys = append(keys, stringKey("team_id", teamID))
+			}
+		}
+
+		requestItems := map[string]types.KeysAndAttributes{
+			tableName: {Keys: keys},
+		}
+		for attempt := 0; len(requestItems) > 0; attempt++ {
+			if attempt > 0 {
+				if attempt > maxBatchRetries {
+					break
+				}
+				// A canceled context cuts the wait short, and the next call
+				// then fails with its error
+				select {
+				case <-ctx.Done():
+				case <-time.After(time.Duration(1<<uint(attempt-1)) * 50 * time.Millisecond):
+				}
+			}
+
+			result, err := r.svc.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{
+				RequestItems: requestItems,
+			})
+			if err != nil {
+				for _, key := range requestItems[tableName].Keys {
+					failed[stringAttr(key, "team_id")] = err
+				}
+				requestItems = nil
+				break
+			}
+
+			for _, item := range result.Responses[tableName] {
+				if team := teamFromItem(item); team.TeamID != "" {
+					found[team.TeamID] = team
+				}
+			}
+			requestItems = result.UnprocessedKeys
+		}
+
+		if unprocessed, exists := requestItems[tableName]; exists {
+			for _, key := range unprocessed.Keys {
+				failed[stringAttr(key, "team_id")] = store.ErrThrottled
+			}
+		}
+	}
+
+	return found, failed
+}
+
+func (r teams) Create(ctx context.Context, team *store.Team) error {
+	_, err := r.svc.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(r.tables.Teams),
+		Item: map[string]types.AttributeValue{
+			"team_id":           &types.AttributeValueMemberS{Value: team.TeamID},
+			"name":              &types.AttributeValueMemberS{Value: team.Name},
+			"created_timestamp": &types.AttributeValueMemberS{Value: team.CreatedTimestamp},
+			"admins":            &types.AttributeValueMemberS{Value: strings.Join(team.Admins, ",")},
+			"members":           &types.AttributeValueMemberS{Value: strings.Join(team.Members, ",")},
+		},
+	})
+	return err
+}
+
+// RemoveUser conditions the update on the roster it read, so a concurrent
+// change such as another user leaving isn't overwritten, and starts over
+// from a fresh read when it was
+func (r teams) RemoveUser(ctx context.Context, teamID, username string) ([]string, error) {
+	const unchangedRoster = "attribute_exists(team_id) AND " +
+		"(attribute_not_exists(admins) OR admins = :oldAdmins) AND " +
+		"(attribute_not_exists(members) OR members = :oldMembers)"
+
+	for attempt := 0; attempt <= maxRosterRetries; attempt++ {
+		result, err := r.svc.GetItem(ctx, &dynamodb.GetItemInput{
+			TableName:      aws.String(r.tables.Teams),
+			Key:            stringKey("team_id", teamID),
+			ConsistentRead: aws.Bool(true),
+		})
+		if err != nil || result.Item == nil {
+			return nil, err
+		}
+		oldAdmins, oldMembers := stringAttr(result.Item, "admins"), stringAttr(result.Item, "members")
+
+		admins := without(splitUsers(oldAdmins), username)
+		members := without(splitUsers(oldMembers), username)
+		if len(admins) == 0 && len(members) > 0 {
+			admins = members[:1]
+		}
+
+		_, err = r.svc.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName:           aws.String(r.tables.Teams),
+			Key:                 stringKey("team_id", teamID),
+			UpdateExpression:    aws.String("SET admins = :admins, members = :members"),
+			ConditionExpression: aws.String(unchangedRoster),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":admins":     &types.AttributeValueMemberS{Value: strings.Join(admins, ",")},
+				":members":    &types.AttributeValueMemberS{Value: strings.Join(members, ",")},
+				":oldAdmins":  &types.AttributeValueMemberS{Value: oldAdmins},
+				":oldMembers": &types.AttributeValueMemberS{Value: oldMembers},
+			},
+		})
+		if conditionFailed(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return admins, nil
+	}
+	return nil, store.ErrConflict
+}
+
+func without(users []string, username string) []string {
+	kept := []string{}
+	for _, user := range users {
+		if user != username {
+			kept = append(kept, user)
+		}
+	}
+	return kept
+}
+
+// Settings are stored as a map attribute, marshaled from the dynamodbav tags
+// of the value passed in
+func (r teams) Settings(ctx context.Context, teamID string, settings interface{}) (bool, error) {
+	result, err := r.svc.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:            aws.String(r.tables.Teams),
+		Key:                  stringKey("team_id", teamID),
+		ProjectionExpression: aws.String("team_id, settings"),
+	})
+	if err != nil {
+		return false, err
+	}
+	if result.Item == nil {
+		return false, store.ErrNotFound
+	}
+
+	stored, ok := result.Item["settings"].(*types.AttributeValueMemberM)
+	if !ok {
+		return false, nil
+	}
+	return true, attributevalue.Unmarshal(stored, settings)
+}
+
+func (r teams) SaveSettings(ctx context.Context, teamID string, settings interface{}) error {
+	av, err := attributevalue.Marshal(settings)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.svc.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(r.tables.Teams),
+		Key:                 stringKey("team_id", teamID),
+		UpdateExpression:    aws.String("SET settings = :settings"),
+		ConditionExpression: aws.String("attribute_exists(team_id)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":settings": av,
+		},
+	})
+	return onConditionFailed(err, store.ErrNotFound)
+}
+
+type tasks struct{ *db }
+
+func taskFromItem(item map[string]types.AttributeValue) store.Task {
+	task := store.Task{
+		TaskID:           stringAttr(item, "task_id"),
+		Title:            stringAttr(item, "title"),
+		TeamID:           stringAttr(item, "team_id"),
+		CreatedTimestamp: stringAttr(item, "created_timestamp"),
+		Schedule:         map[string]store.TimeSlot{},
+		TaskType:         stringAttr(item, "task_type"),
+		TimeZone:         stringAttr(item, "time_zone"),
+		Requester:        stringAttr(item, "requester"),
+	}
+	if schedule, ok := item["schedule"].(*types.AttributeValueMemberM); ok {
+		for day, slot := range schedule.Value {
+			if slot, ok := slot.(*types.AttributeValueMemberM); ok {
+				task.Schedule[day] = store.TimeSlot{
+					BeginTime: stringAttr(slot.Value, "begin_time"),
+					EndTime:   stringAttr(slot.Value, "end_time"),
+				}
+			}
+		}
+	}
+	return task
+}
+
+func (r tasks) Create(ctx context.Context, task *store.Task) error {
+	schedule := make(map[string]types.AttributeValue)
+	for day, slot := range task.Schedule {
+		schedule[day] = &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+			"begin_time": &types.AttributeValueMemberS{Value: slot.BeginTime},
+			"end_time":   &types.AttributeValueMemberS{Value: slot.EndTime},
+		}}
+	}
+
+	_, err := r.svc.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(r.tables.Tasks),
+		Item: map[string]types.AttributeValue{
+			"task_id":           &types.AttributeValueMemberS{Value: task.TaskID},
+			"title":             &types.AttributeValueMemberS{Value: task.Title},
+			"team_id":           &types.AttributeValueMemberS{Value: task.TeamID},
+			"created_timestamp": &types.AttributeValueMemberS{Value: task.CreatedTimestamp},
+			"schedule":          &types.AttributeValueMemberM{Value: schedule},
+			"task_type":         &types.AttributeValueMemberS{Value: task.TaskType},
+			"time_zone":         &types.AttributeValueMemberS{Value: task.TimeZone},
+			"requester":         &types.AttributeValueMemberS{Value: task.Requester},
+		},
+	})
+	return err
+}
+
+func (r tasks) ListByRequester(ctx context.Context, username string) ([]store.Task, error) {
+	var found []store.Task
+	pages := dynamodb.NewQueryPaginator(r.svc, &dynamodb.QueryInput{
+		TableName:              aws.String(r.tables.Tasks),
+		IndexName:              aws.String(tasksByRequesterIndex),
+		KeyConditionExpression: aws.String("requester = :requester"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":requester": &types.AttributeValueMemberS{Value: username},
+		},
+	})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return found, err
+		}
+		for _, item := range page.Items {
+			found = append(found, taskFromItem(item))
+		}
+	}
+	return found, nil
+}
+
+func (r tasks) SetRequester(ctx context.Context, taskID, username string) error {
+	_, err := r.svc.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:        aws.String(r.tables.Tasks),
+		Key:              stringKey("task_id", taskID),
+		UpdateExpression: aws.String("SET requester = :requester"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":requester": &types.AttributeValueMemberS{Value: username},
+		},
+	})
+	return err
+}
+
+func (r tasks) Delete(ctx context.Context, taskID string) error {
+	_, err := r.svc.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(r.tables.Tasks),
+		Key:       stringKey("task_id", taskID),
+	})
+	return err
+}
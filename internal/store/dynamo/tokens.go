@@ -0,0 +1,530 @@
+package dynamo
+
+import (
+	"context"
+	"strconv"
+
+	"agendum/internal/store"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// queryByUsername returns every item of a table's username-index for a user
+func (d *db) queryByUsername(ctx context.Context, tableName, username string) ([]map[string]types.AttributeValue, error) {
+	var items []map[string]types.AttributeValue
+	pages := dynamodb.NewQueryPaginator(d.svc, &dynamodb.QueryInput{
+		TableName:              aws.String(tableName),
+		IndexName:              aws.String(byUsernameIndex),
+		KeyConditionExpression: aws.String("username = :username"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":username": &types.AttributeValueMemberS{Value: username},
+		},
+	})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return items, err
+		}
+		items = append(items, page.Items...)
+	}
+	return items, nil
+}
+
+func (d *db) deleteToken(ctx context.Context, tableName, token string) error {
+	_, err := d.svc.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(tableName),
+		Key:       stringKey("token", token),
+	})
+	return err
+}
+
+func (d *db) getToken(ctx context.Context, tableName, token string, consistent bool) (map[string]types.AttributeValue, error) {
+	result, err := d.svc.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(tableName),
+		Key:            stringKey("token", token),
+		ConsistentRead: aws.Bool(consistent),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.Item, nil
+}
+
+// scanUnhashed returns every item of a table keyed by a raw token rather
+// than its hash
+func (d *db) scanUnhashed(ctx context.Context, tableName string) ([]map[string]types.AttributeValue, error) {
+	var items []map[string]types.AttributeValue
+	pages := dynamodb.NewScanPaginator(d.svc, &dynamodb.ScanInput{
+		TableName:        aws.String(tableName),
+		FilterExpression: aws.String("size(#token) <> :length"),
+		ExpressionAttributeNames: map[string]string{
+			"#token": "token",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":length": number(store.HashedKeyLength),
+		},
+	})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return items, err
+		}
+		items = append(items, page.Items...)
+	}
+	return items, nil
+}
+
+type sessions struct{ *db }
+
+func sessionFromItem(item map[string]types.AttributeValue) store.Session {
+	return store.Session{
+		Token:          stringAttr(item, "token"),
+		SessionID:      stringAttr(item, "session_id"),
+		Username:       stringAttr(item, "username"),
+		CreatedAt:      stringAttr(item, "created_at"),
+		ExpiresAt:      stringAttr(item, "expires_at"),
+		UserAgent:      stringAttr(item, "user_agent"),
+		ExpiresAtEpoch: numberAttr(item, ttlAttribute),
+		ReadOnly:       boolAttr(item, "read_only"),
+	}
+}
+
+func (r sessions) Put(ctx context.Context, s *store.Session) error {
+	_, err := r.svc.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(r.tables.Sessions),
+		Item: map[string]types.AttributeValue{
+			"token":      &types.AttributeValueMemberS{Value: s.Token},
+			"session_id": &types.AttributeValueMemberS{Value: s.SessionID},
+			"username":   &types.AttributeValueMemberS{Value: s.Username},
+			"created_at": &types.AttributeValueMemberS{Value: s.CreatedAt},
+			"expires_at": &types.AttributeValueMemberS{Value: s.ExpiresAt},
+			"user_agent": &types.AttributeValueMemberS{Value: s.UserAgent},
+			ttlAttribute: number(s.ExpiresAtEpoch),
+			"read_only":  &types.AttributeValueMemberBOOL{Value: s.ReadOnly},
+		},
+	})
+	return err
+}
+
+// Get reads eventually consistently: it runs on every request, and a session
+// is never used in the instant after it's written
+func (r sessions) Get(ctx context.Context, token string) (*store.Session, error) {
+	item, err := r.getToken(ctx, r.tables.Sessions, token, false)
+	if err != nil || item == nil {
+		return nil, err
+	}
+	s := sessionFromItem(item)
+	return &s, nil
+}
+
+func (r sessions) ListByUser(ctx context.Context, username string) ([]store.Session, error) {
+	items, err := r.queryByUsername(ctx, r.tables.Sessions, username)
+	var found []store.Session
+	for _, item := range items {
+		found = append(found, sessionFromItem(item))
+	}
+	return found, err
+}
+
+func (r sessions) Delete(ctx context.Context, token string) error {
+	return r.deleteToken(ctx, r.tables.Sessions, token)
+}
+
+func (r sessions) ListWithoutExpiry(ctx context.Context) ([]store.Session, error) {
+	var found []store.Session
+	pages := dynamodb.NewScanPaginator(r.svc, &dynamodb.ScanInput{
+		TableName:        aws.String(r.tables.Sessions),
+		FilterExpression: aws.String("attribute_not_exists(#ttl)"),
+		ExpressionAttributeNames: map[string]string{
+			"#ttl": ttlAttribute,
+		},
+	})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return found, err
+		}
+		for _, item := range page.Items {
+			found = append(found, sessionFromItem(item))
+		}
+	}
+	return found, nil
+}
+
+func (r sessions) SetExpiry(ctx context.Context, token string, expiresAtEpoch int64) error {
+	_, err := r.svc.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(r.tables.Sessions),
+		Key:                 stringKey("token", token),
+		UpdateExpression:    aws.String("SET #ttl = :ttl"),
+		ConditionExpression: aws.String("attribute_exists(#token)"),
+		ExpressionAttributeNames: map[string]string{
+			"#ttl":   ttlAttribute,
+			"#token": "token",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":ttl": number(expiresAtEpoch),
+		},
+	})
+	return onConditionFailed(err, store.ErrNotFound)
+}
+
+func (r sessions) ListUnhashed(ctx context.Context) ([]store.Session, error) {
+	items, err := r.scanUnhashed(ctx, r.tables.Sessions)
+	var found []store.Session
+	for _, item := range items {
+		found = append(found, sessionFromItem(item))
+	}
+	return found, err
+}
+
+type refreshTokens struct{ *db }
+
+func refreshTokenFromItem(item map[string]types.AttributeValue) store.RefreshToken {
+	return store.RefreshToken{
+		Token:            stringAttr(item, "token"),
+		SessionID:        stringAttr(item, "session_id"),
+		Username:         stringAttr(item, "username"),
+		SessionCreatedAt: stringAttr(item, "session_created_at"),
+		UserAgent:        stringAttr(item, "user_agent"),
+		ExpiresAtEpoch:   numberAttr(item, ttlAttribute),
+		Used:             boolAttr(item, "used"),
+	}
+}
+
+func (r refreshTokens) Put(ctx context.Context, rt *store.RefreshToken) error {
+	_, err := r.svc.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(r.tables.RefreshTokens),
+		Item: map[string]types.AttributeValue{
+			"token":              &types.AttributeValueMemberS{Value: rt.Token},
+			"session_id":         &types.AttributeValueMemberS{Value: rt.SessionID},
+			"username":           &types.AttributeValueMemberS{Value: rt.Username},
+			"session_created_at": &types.AttributeValueMemberS{Value: rt.SessionCreatedAt},
+			"user_agent":         &types.AttributeValueMemberS{Value: rt.UserAgent},
+			"used":               &types.AttributeValueMemberBOOL{Value: rt.Used},
+			ttlAttribute:         number(rt.ExpiresAtEpoch),
+		},
+	})
+	return err
+}
+
+func (r refreshTokens) Get(ctx context.Context, token string) (*store.RefreshToken, error) {
+	item, err := r.getToken(ctx, r.tables.RefreshTokens, token, true)
+	if err != nil || item == nil {
+		return nil, err
+	}
+	rt := refreshTokenFromItem(item)
+	return &rt, nil
+}
+
+func (r refreshTokens) ListByUser(ctx context.Context, username string) ([]store.RefreshToken, error) {
+	if r.tables.RefreshTokens == "" {
+		return nil, nil
+	}
+	items, err := r.queryByUsername(ctx, r.tables.RefreshTokens, username)
+	var found []store.RefreshToken
+	for _, item := range items {
+		found = append(found, refreshTokenFromItem(item))
+	}
+	return found, err
+}
+
+func (r refreshTokens) MarkUsed(ctx context.Context, token string) error {
+	_, err := r.svc.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(r.tables.RefreshTokens),
+		Key:                 stringKey("token", token),
+		UpdateExpression:    aws.String("SET used = :true"),
+		ConditionExpression: aws.String("attribute_exists(#token) AND used = :false"),
+		ExpressionAttributeNames: map[string]string{
+			"#token": "token",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":true":  &types.AttributeValueMemberBOOL{Value: true},
+			":false": &types.AttributeValueMemberBOOL{Value: false},
+		},
+	})
+	return onConditionFailed(err, store.ErrConflict)
+}
+
+func (r refreshTokens) Delete(ctx context.Context, token string) error {
+	return r.deleteToken(ctx, r.tables.RefreshTokens, token)
+}
+
+func (r refreshTokens) ListUnhashed(ctx context.Context) ([]store.RefreshToken, error) {
+	if r.tables.RefreshTokens == "" {
+		return nil, nil
+	}
+	items, err := r.scanUnhashed(ctx, r.tables.RefreshTokens)
+	var found []store.RefreshToken
+	for _, item := range items {
+		found = append(found, refreshTokenFromItem(item))
+	}
+	return found, err
+}
+
+type accessTokens struct{ *db }
+
+func accessTokenFromItem(item map[string]types.AttributeValue) store.AccessToken {
+	at := store.AccessToken{
+		Token:          stringAttr(item, "token"),
+		TokenID:        stringAttr(item, "token_id"),
+		Username:       stringAttr(item, "username"),
+		Name:           stringAttr(item, "name"),
+		Scopes:         []string{},
+		CreatedBy:      stringAttr(item, "created_by"),
+		CreatedAt:      stringAttr(item, "created_at"),
+		LastUsedAt:     stringAttr(item, "last_used_at"),
+		ExpiresAtEpoch: numberAttr(item, ttlAttribute),
+	}
+	if attr, ok := item["scopes"].(*types.AttributeValueMemberSS); ok {
+		at.Scopes = append(at.Scopes, attr.Value...)
+	}
+	return at
+}
+
+func (r accessTokens) Put(ctx context.Context, at *store.AccessToken) error {
+	item := map[string]types.AttributeValue{
+		"token":      &types.AttributeValueMemberS{Value: at.Token},
+		"token_id":   &types.AttributeValueMemberS{Value: at.TokenID},
+		"username":   &types.AttributeValueMemberS{Value: at.Username},
+		"name":       &types.AttributeValueMemberS{Value: at.Name},
+		"scopes":     &types.AttributeValueMemberSS{Value: at.Scopes},
+		"created_by": &types.AttributeValueMemberS{Value: at.CreatedBy},
+		"created_at": &types.AttributeValueMemberS{Value: at.CreatedAt},
+		ttlAttribute: number(at.ExpiresAtEpoch),
+	}
+	if at.LastUsedAt != "" {
+		item["last_used_at"] = &types.AttributeValueMemberS{Value: at.LastUsedAt}
+	}
+
+	_, err := r.svc.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(r.tables.AccessTokens),
+		Item:      item,
+	})
+	return err
+}
+
+func (r accessTokens) Get(ctx context.Context, token string) (*store.AccessToken, error) {
+	item, err := r.getToken(ctx, r.tables.AccessTokens, token, false)
+	if err != nil || item == nil {
+		return nil, err
+	}
+	at := accessTokenFromItem(item)
+	return &at, nil
+}
+
+func (r accessTokens) ListByUser(ctx context.Context, username string) ([]store.AccessToken, error) {
+	if r.tables.AccessTokens == "" {
+		return nil, nil
+	}
+	items, err := r.queryByUsername(ctx, r.tables.AccessTokens, username)
+	var found []store.AccessToken
+	for _, item := range items {
+		found = append(found, accessTokenFromItem(item))
+	}
+	return found, err
+}
+
+func (r accessTokens) Touch(ctx context.Context, token, lastUsedAt string) error {
+	_, err := r.svc.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:        aws.String(r.tables.AccessTokens),
+		Key:              stringKey("token", token),
+		UpdateExpression: aws.String("SET last_used_at = :now"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now": &types.AttributeValueMemberS{Value: lastUsedAt},
+		},
+	})
+	return err
+}
+
+func (r accessTokens) Delete(ctx context.Context, token string) error {
+	return r.deleteToken(ctx, r.tables.AccessTokens, token)
+}
+
+type oneTimeTokens struct{ *db }
+
+func oneTimeTokenFromItem(item map[string]types.AttributeValue) *store.OneTimeToken {
+	ott := &store.OneTimeToken{
+		Token:          stringAttr(item, "token"),
+		Kind:           stringAttr(item, "kind"),
+		Username:       stringAttr(item, "username"),
+		Attempts:       int(numberAttr(item, "attempts")),
+		ExpiresAtEpoch: numberAttr(item, ttlAttribute),
+	}
+	if attr, ok := item["data"].(*types.AttributeValueMemberM); ok {
+		ott.Data = make(map[string]string, len(attr.Value))
+		for k := range attr.Value {
+			ott.Data[k] = stringAttr(attr.Value, k)
+		}
+	}
+	return ott
+}
+
+func (r oneTimeTokens) Put(ctx context.Context, ott *store.OneTimeToken) error {
+	item := map[string]types.AttributeValue{
+		"token":      &types.AttributeValueMemberS{Value: ott.Token},
+		"kind":       &types.AttributeValueMemberS{Value: ott.Kind},
+		"username":   &types.AttributeValueMemberS{Value: ott.Username},
+		"attempts":   &types.AttributeValueMemberN{Value: strconv.Itoa(ott.Attempts)},
+		ttlAttribute: number(ott.ExpiresAtEpoch),
+	}
+	if len(ott.Data) > 0 {
+		values := make(map[string]types.AttributeValue, len(ott.Data))
+		for k, v := range ott.Data {
+			values[k] = &types.AttributeValueMemberS{Value: v}
+		}
+		item["data"] = &types.AttributeValueMemberM{Value: values}
+	}
+
+	_, err := r.svc.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(r.tables.OneTimeTokens),
+		Item:      item,
+	})
+	return err
+}
+
+func (r oneTimeTokens) Get(ctx context.Context, token string) (*store.OneTimeToken, error) {
+	item, err := r.getToken(ctx, r.tables.OneTimeTokens, token, true)
+	if err != nil || item == nil {
+		return nil, err
+	}
+	return oneTimeTokenFromItem(item), nil
+}
+
+func (r oneTimeTokens) Consume(ctx context.Context, token, kind string, now int64) (*store.OneTimeToken, error) {
+	result, err := r.svc.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:           aws.String(r.tables.OneTimeTokens),
+		Key:                 stringKey("token", token),
+		ConditionExpression: aws.String("kind = :kind AND expires_at_epoch > :now"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":kind": &types.AttributeValueMemberS{Value: kind},
+			":now":  number(now),
+		},
+		ReturnValues: types.ReturnValueAllOld,
+	})
+	if err != nil {
+		return nil, onConditionFailed(err, store.ErrNotFound)
+	}
+	return oneTimeTokenFromItem(result.Attributes), nil
+}
+
+func (r oneTimeTokens) AddAttempt(ctx context.Context, token string) (int, error) {
+	result, err := r.svc.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(r.tables.OneTimeTokens),
+		Key:                 stringKey("token", token),
+		UpdateExpression:    aws.String("ADD attempts :one"),
+		ConditionExpression: aws.String("attribute_exists(#token)"),
+		ExpressionAttributeNames: map[string]string{
+			"#token": "token",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":one": &types.AttributeValueMemberN{Value: "1"},
+		},
+		ReturnValues: types.ReturnValueUpdatedNew,
+	})
+	if err != nil {
+		return 0, onConditionFailed(err, store.ErrNotFound)
+	}
+	return int(numberAttr(result.Attributes, "attempts")), nil
+}
+
+func (r oneTimeTokens) Delete(ctx context.Context, token string) error {
+	return r.deleteToken(ctx, r.tables.OneTimeTokens, token)
+}
+
+type loginAttempts struct{ *db }
+
+func (r loginAttempts) Get(ctx context.Context, key string) (*store.LoginAttempt, error) {
+	result, err := r.svc.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(r.tables.LoginAttempts),
+		Key:       stringKey("key", key),
+	})
+	if err != nil || result.Item == nil {
+		return nil, err
+	}
+	return &store.LoginAttempt{
+		Key:         key,
+		Failures:    int(numberAttr(result.Item, "failures")),
+		LockedUntil: numberAttr(result.Item, "locked_until"),
+	}, nil
+}
+
+func (r loginAttempts) AddFailure(ctx context.Context, key, failedAt string, expiresAtEpoch int64) (int, error) {
+	result, err := r.svc.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:        aws.String(r.tables.LoginAttempts),
+		Key:              stringKey("key", key),
+		UpdateExpression: aws.String("ADD failures :one SET last_failure_at = :now, expires_at_epoch = :expires"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":one":     &types.AttributeValueMemberN{Value: "1"},
+			":now":     &types.AttributeValueMemberS{Value: failedAt},
+			":expires": number(expiresAtEpoch),
+		},
+		ReturnValues: types.ReturnValueUpdatedNew,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int(numberAttr(result.Attributes, "failures")), nil
+}
+
+func (r loginAttempts) Lock(ctx context.Context, key string, lockedUntil int64) error {
+	_, err := r.svc.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:        aws.String(r.tables.LoginAttempts),
+		Key:              stringKey("key", key),
+		UpdateExpression: aws.String("SET locked_until = :until"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":until": number(lockedUntil),
+		},
+	})
+	return err
+}
+
+func (r loginAttempts) Clear(ctx context.Context, key string) error {
+	_, err := r.svc.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(r.tables.LoginAttempts),
+		Key:       stringKey("key", key),
+	})
+	return err
+}
+
+type revokedTokens struct{ *db }
+
+func (r revokedTokens) Put(ctx context.Context, key string, revokedAt, expiresAtEpoch int64) error {
+	if r.tables.RevokedTokens == "" {
+		return nil
+	}
+	_, err := r.svc.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(r.tables.RevokedTokens),
+		Item: map[string]types.AttributeValue{
+			"key":        &types.AttributeValueMemberS{Value: key},
+			"revoked_at": number(revokedAt),
+			ttlAttribute: number(expiresAtEpoch),
+		},
+	})
+	return err
+}
+
+func (r revokedTokens) All(ctx context.Context) (map[string]int64, error) {
+	entries := make(map[string]int64)
+	if r.tables.RevokedTokens == "" {
+		return entries, nil
+	}
+
+	pages := dynamodb.NewScanPaginator(r.svc, &dynamodb.ScanInput{
+		TableName: aws.String(r.tables.RevokedTokens),
+	})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return entries, err
+		}
+		for _, item := range page.Items {
+			key, revokedAt := stringAttr(item, "key"), numberAttr(item, "revoked_at")
+			if key != "" && revokedAt != 0 {
+				entries[key] = revokedAt
+			}
+		}
+	}
+	return entries, nil
+}
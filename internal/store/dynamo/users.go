@@ -0,0 +1,451 @@
+package dynamo
+
+import (
+	"context"
+
+	"agendum/internal/store"
+	"agendum/pkg/utils"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+type users struct{ *db }
+
+func userFromItem(item map[string]types.AttributeValue) *store.User {
+	u := &store.User{
+		Username:                stringAttr(item, "username"),
+		Email:                   stringAttr(item, "email"),
+		Password:                stringAttr(item, "password"),
+		FirstName:               stringAttr(item, "firstName"),
+		LastName:                stringAttr(item, "lastName"),
+		UserType:                stringAttr(item, "userType"),
+		TeamIDs:                 []string{},
+		Preferences:             map[string]string{},
+		EmailVerified:           true,
+		OIDCSubject:             stringAttr(item, "oidc_subject"),
+		OwnerTeamID:             stringAttr(item, "owner_team_id"),
+		CreatedBy:               stringAttr(item, "created_by"),
+		MFAEnabled:              boolAttr(item, "mfa_enabled"),
+		MFASecret:               stringAttr(item, "mfa_secret"),
+		MFAPendingSecret:        stringAttr(item, "mfa_pending_secret"),
+		MFALastStep:             numberAttr(item, "mfa_last_step"),
+		VerificationSentAt:      numberAttr(item, "verification_sent_at"),
+		VerificationWindowStart: numberAttr(item, "verification_window_start"),
+		VerificationSends:       numberAttr(item, "verification_sends"),
+		ResetSentAt:             numberAttr(item, "reset_sent_at"),
+		ResetWindowStart:        numberAttr(item, "reset_window_start"),
+		ResetSends:              numberAttr(item, "reset_sends"),
+	}
+	// Accounts created before verification existed have no flag
+	if attr, ok := item["email_verified"].(*types.AttributeValueMemberBOOL); ok {
+		u.EmailVerified = attr.Value
+	}
+	if teamIDs, ok := item["teamIds"].(*types.AttributeValueMemberL); ok {
+		for _, teamID := range teamIDs.Value {
+			if teamID, ok := teamID.(*types.AttributeValueMemberS); ok {
+				u.TeamIDs = append(u.TeamIDs, teamID.Value)
+			}
+		}
+	}
+	if preferences, ok := item["preferences"].(*types.AttributeValueMemberM); ok {
+		for key, value := range preferences.Value {
+			if value, ok := value.(*types.AttributeValueMemberS); ok {
+				u.Preferences[key] = value.Value
+			}
+		}
+	}
+	if codes, ok := item["mfa_recovery_codes"].(*types.AttributeValueMemberSS); ok {
+		u.MFARecoveryCodes = codes.Value
+	}
+	return u
+}
+
+// userItem stores only the attributes that are set, like the items written
+// before this package existed
+func userItem(u *store.User) map[string]types.AttributeValue {
+	item := map[string]types.AttributeValue{
+		"username":  &types.AttributeValueMemberS{Value: u.Username},
+		"firstName": &types.AttributeValueMemberS{Value: u.FirstName},
+		"lastName":  &types.AttributeValueMemberS{Value: u.LastName},
+		"userType":  &types.AttributeValueMemberS{Value: u.UserType},
+	}
+	teamIDs := []types.AttributeValue{}
+	for _, teamID := range u.TeamIDs {
+		teamIDs = append(teamIDs, &types.AttributeValueMemberS{Value: teamID})
+	}
+	item["teamIds"] = &types.AttributeValueMemberL{Value: teamIDs}
+	optional := map[string]string{
+		"email":              u.Email,
+		"password":           u.Password,
+		"oidc_subject":       u.OIDCSubject,
+		"owner_team_id":      u.OwnerTeamID,
+		"created_by":         u.CreatedBy,
+		"mfa_secret":         u.MFASecret,
+		"mfa_pending_secret": u.MFAPendingSecret,
+	}
+	for name, value := range optional {
+		if value != "" {
+			item[name] = &types.AttributeValueMemberS{Value: value}
+		}
+	}
+	// Accounts without an email, such as service accounts, have nothing to
+	// verify
+	if u.Email != "" {
+		item["email_verified"] = &types.AttributeValueMemberBOOL{Value: u.EmailVerified}
+	}
+	if len(u.Preferences) > 0 {
+		item["preferences"] = preferencesAttr(u.Preferences)
+	}
+	if u.MFAEnabled {
+		item["mfa_enabled"] = &types.AttributeValueMemberBOOL{Value: true}
+		item["mfa_last_step"] = number(u.MFALastStep)
+	}
+	if len(u.MFARecoveryCodes) > 0 {
+		item["mfa_recovery_codes"] = &types.AttributeValueMemberSS{Value: u.MFARecoveryCodes}
+	}
+	if u.VerificationSentAt != 0 {
+		item["verification_sent_at"] = number(u.VerificationSentAt)
+		item["verification_window_start"] = number(u.VerificationWindowStart)
+		item["verification_sends"] = number(u.VerificationSends)
+	}
+	return item
+}
+
+func preferencesAttr(preferences map[string]string) types.AttributeValue {
+	values := make(map[string]types.AttributeValue, len(preferences))
+	for key, value := range preferences {
+		values[key] = &types.AttributeValueMemberS{Value: value}
+	}
+	return &types.AttributeValueMemberM{Value: values}
+}
+
+func (r users) Get(ctx context.Context, username string) (*store.User, error) {
+	result, err := r.svc.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(r.tables.Users),
+		Key:            stringKey("username", username),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil || result.Item == nil {
+		return nil, err
+	}
+	return userFromItem(result.Item), nil
+}
+
+func (r users) FindByEmail(ctx context.Context, email string) (*store.User, error) {
+	result, err := r.svc.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(r.tables.Users),
+		IndexName:              aws.String(usersByEmailIndex),
+		KeyConditionExpression: aws.String("email = :email"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":email": &types.AttributeValueMemberS{Value: email},
+		},
+	})
+	if err != nil || len(result.Items) == 0 {
+		return nil, err
+	}
+	return userFromItem(result.Items[0]), nil
+}
+
+func (r users) EmailOwner(ctx context.Context, email string) (string, error) {
+	result, err := r.svc.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(r.tables.UserEmails),
+		Key:       stringKey("email", email),
+	})
+	if err != nil {
+		return "", err
+	}
+	return stringAttr(result.Item, "username"), nil
+}
+
+// Create writes the user and its email reservation together so neither the
+// username nor the email can be claimed twice
+func (r users) Create(ctx context.Context, user *store.User) error {
+	// Users created before the UserEmails table existed have no reservation,
+	// so their emails are only found through the email index
+	if user.Email != "" {
+		existing, err := r.FindByEmail(ctx, user.Email)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			return store.ErrEmailTaken
+		}
+	}
+
+	items := []types.TransactWriteItem{
+		{
+			Put: &types.Put{
+				TableName:           aws.String(r.tables.Users),
+				Item:                userItem(user),
+				ConditionExpression: aws.String("attribute_not_exists(username)"),
+			},
+		},
+	}
+	if user.Email != "" {
+		items = append(items, types.TransactWriteItem{
+			Put: &types.Put{
+				TableName: aws.String(r.tables.UserEmails),
+				Item: map[string]types.AttributeValue{
+					"email":    &types.AttributeValueMemberS{Value: user.Email},
+					"username": &types.AttributeValueMemberS{Value: user.Username},
+				},
+				ConditionExpression: aws.String("attribute_not_exists(email)"),
+			},
+		})
+	}
+
+	_, err := r.svc.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: items})
+	if reasons := cancellationReasons(err); reasons != nil {
+		if len(reasons) > 0 && reasons[0] == "ConditionalCheckFailed" {
+			return store.ErrUsernameTaken
+		}
+		if len(reasons) > 1 && reasons[1] == "ConditionalCheckFailed" {
+			return store.ErrEmailTaken
+		}
+	}
+	return err
+}
+
+// CreateServiceAccount conditions the roster update on the roster it read,
+// so a concurrent change isn't overwritten
+func (r users) CreateServiceAccount(ctx context.Context, user *store.User, role string) error {
+	team, err := r.svc.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(r.tables.Teams),
+		Key:            stringKey("team_id", user.OwnerTeamID),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return err
+	}
+	if team.Item == nil {
+		return store.ErrNotFound
+	}
+
+	roster := role + "s"
+	existing := stringAttr(team.Item, roster)
+	updated := user.Username
+	if existing != "" {
+		updated = existing + "," + user.Username
+	}
+
+	_, err = r.svc.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{
+				Put: &types.Put{
+					TableName:           aws.String(r.tables.Users),
+					Item:                userItem(user),
+					ConditionExpression: aws.String("attribute_not_exists(username)"),
+				},
+			},
+			{
+				Update: &types.Update{
+					TableName:           aws.String(r.tables.Teams),
+					Key:                 stringKey("team_id", user.OwnerTeamID),
+					UpdateExpression:    aws.String("SET #roster = :updated"),
+					ConditionExpression: aws.String("attribute_not_exists(#roster) OR #roster = :current"),
+					ExpressionAttributeNames: map[string]string{
+						"#roster": roster,
+					},
+					ExpressionAttributeValues: map[string]types.AttributeValue{
+						":updated": &types.AttributeValueMemberS{Value: updated},
+						":current": &types.AttributeValueMemberS{Value: existing},
+					},
+				},
+			},
+		},
+	})
+	if reasons := cancellationReasons(err); reasons != nil {
+		if len(reasons) > 0 && reasons[0] == "ConditionalCheckFailed" {
+			return store.ErrUsernameTaken
+		}
+		return store.ErrConflict
+	}
+	return err
+}
+
+func (r users) Delete(ctx context.Context, username string) error {
+	result, err := r.svc.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:    aws.String(r.tables.Users),
+		Key:          stringKey("username", username),
+		ReturnValues: types.ReturnValueAllOld,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Release the email so it can be used to sign up again, unless the
+	// reservation belongs to someone else
+	email := utils.NormalizeEmail(stringAttr(result.Attributes, "email"))
+	if email == "" {
+		return nil
+	}
+	_, err = r.svc.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:           aws.String(r.tables.UserEmails),
+		Key:                 stringKey("email", email),
+		ConditionExpression: aws.String("username = :username"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":username": &types.AttributeValueMemberS{Value: username},
+		},
+	})
+	if conditionFailed(err) {
+		return nil
+	}
+	return err
+}
+
+// update runs an UpdateItem on a user
+func (r users) update(ctx context.Context, username, expression, condition string, values map[string]types.AttributeValue) error {
+	input := &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(r.tables.Users),
+		Key:                       stringKey("username", username),
+		UpdateExpression:          aws.String(expression),
+		ExpressionAttributeValues: values,
+	}
+	if condition != "" {
+		input.ConditionExpression = aws.String(condition)
+	}
+	_, err := r.svc.UpdateItem(ctx, input)
+	return err
+}
+
+func (r users) UpdateProfile(ctx context.Context, username, firstName, lastName string, preferences map[string]string) error {
+	err := r.update(ctx, username,
+		"SET firstName = :firstName, lastName = :lastName, preferences = :preferences",
+		"attribute_exists(username)",
+		map[string]types.AttributeValue{
+			":firstName":   &types.AttributeValueMemberS{Value: firstName},
+			":lastName":    &types.AttributeValueMemberS{Value: lastName},
+			":preferences": preferencesAttr(preferences),
+		})
+	return onConditionFailed(err, store.ErrNotFound)
+}
+
+func (r users) SetPassword(ctx context.Context, username, hash string) error {
+	err := r.update(ctx, username, "SET password = :password", "attribute_exists(username)",
+		map[string]types.AttributeValue{
+			":password": &types.AttributeValueMemberS{Value: hash},
+		})
+	return onConditionFailed(err, store.ErrNotFound)
+}
+
+func (r users) ReplacePassword(ctx context.Context, username, oldHash, newHash string) error {
+	err := r.update(ctx, username, "SET password = :password", "password = :old",
+		map[string]types.AttributeValue{
+			":password": &types.AttributeValueMemberS{Value: newHash},
+			":old":      &types.AttributeValueMemberS{Value: oldHash},
+		})
+	return onConditionFailed(err, store.ErrConflict)
+}
+
+func (r users) SetUserType(ctx context.Context, username, userType string) error {
+	err := r.update(ctx, username, "SET userType = :type",
+		"attribute_exists(username) AND (attribute_not_exists(userType) OR userType <> :service)",
+		map[string]types.AttributeValue{
+			":type":    &types.AttributeValueMemberS{Value: userType},
+			":service": &types.AttributeValueMemberS{Value: store.ServiceUserType},
+		})
+	return onConditionFailed(err, store.ErrNotFound)
+}
+
+func (r users) AddTeam(ctx context.Context, username, teamID string) error {
+	err := r.update(ctx, username,
+		"SET teamIds = list_append(if_not_exists(teamIds, :empty_list), :teamId)",
+		"attribute_exists(username)",
+		map[string]types.AttributeValue{
+			":teamId":     &types.AttributeValueMemberL{Value: []types.AttributeValue{&types.AttributeValueMemberS{Value: teamID}}},
+			":empty_list": &types.AttributeValueMemberL{Value: []types.AttributeValue{}},
+		})
+	return onConditionFailed(err, store.ErrNotFound)
+}
+
+func (r users) MarkEmailVerified(ctx context.Context, username, email string) error {
+	err := r.update(ctx, username, "SET email_verified = :true", "email = :email",
+		map[string]types.AttributeValue{
+			":true":  &types.AttributeValueMemberBOOL{Value: true},
+			":email": &types.AttributeValueMemberS{Value: email},
+		})
+	return onConditionFailed(err, store.ErrConflict)
+}
+
+func (r users) RecordVerificationSent(ctx context.Context, username string, lastSent, sentAt, windowStart, sends int64) error {
+	return r.recordSent(ctx, username, "verification", lastSent, sentAt, windowStart, sends)
+}
+
+func (r users) RecordPasswordResetSent(ctx context.Context, username string, lastSent, sentAt, windowStart, sends int64) error {
+	return r.recordSent(ctx, username, "reset", lastSent, sentAt, windowStart, sends)
+}
+
+// recordSent stores the <prefix>_sent_at, <prefix>_window_start and
+// <prefix>_sends counters of an email that is rate limited
+func (r users) recordSent(ctx context.Context, username, prefix string, lastSent, sentAt, windowStart, sends int64) error {
+	condition := prefix + "_sent_at = :last"
+	values := map[string]types.AttributeValue{
+		":now":    number(sentAt),
+		":window": number(windowStart),
+		":sends":  number(sends),
+	}
+	if lastSent == 0 {
+		condition = "attribute_exists(username) AND attribute_not_exists(" + prefix + "_sent_at)"
+	} else {
+		values[":last"] = number(lastSent)
+	}
+
+	err := r.update(ctx, username,
+		"SET "+prefix+"_sent_at = :now, "+prefix+"_window_start = :window, "+prefix+"_sends = :sends",
+		condition, values)
+	return onConditionFailed(err, store.ErrConflict)
+}
+
+func (r users) LinkOIDCSubject(ctx context.Context, username, subject string) error {
+	err := r.update(ctx, username,
+		"SET oidc_subject = :subject, email_verified = :true",
+		"attribute_exists(username) AND (attribute_not_exists(oidc_subject) OR oidc_subject = :subject)",
+		map[string]types.AttributeValue{
+			":subject": &types.AttributeValueMemberS{Value: subject},
+			":true":    &types.AttributeValueMemberBOOL{Value: true},
+		})
+	return onConditionFailed(err, store.ErrConflict)
+}
+
+func (r users) SetMFAPendingSecret(ctx context.Context, username, secret string) error {
+	err := r.update(ctx, username, "SET mfa_pending_secret = :secret", "attribute_exists(username)",
+		map[string]types.AttributeValue{
+			":secret": &types.AttributeValueMemberS{Value: secret},
+		})
+	return onConditionFailed(err, store.ErrNotFound)
+}
+
+func (r users) EnableMFA(ctx context.Context, username, secret string, recoveryCodes []string, step int64) error {
+	err := r.update(ctx, username,
+		"SET mfa_secret = :secret, mfa_enabled = :true, mfa_recovery_codes = :codes, mfa_last_step = :step REMOVE mfa_pending_secret",
+		"mfa_pending_secret = :secret",
+		map[string]types.AttributeValue{
+			":secret": &types.AttributeValueMemberS{Value: secret},
+			":true":   &types.AttributeValueMemberBOOL{Value: true},
+			":codes":  &types.AttributeValueMemberSS{Value: recoveryCodes},
+			":step":   number(step),
+		})
+	return onConditionFailed(err, store.ErrConflict)
+}
+
+func (r users) AdvanceMFAStep(ctx context.Context, username string, step int64) error {
+	err := r.update(ctx, username, "SET mfa_last_step = :step",
+		"attribute_exists(username) AND (attribute_not_exists(mfa_last_step) OR mfa_last_step < :step)",
+		map[string]types.AttributeValue{
+			":step": number(step),
+		})
+	return onConditionFailed(err, store.ErrConflict)
+}
+
+func (r users) UseRecoveryCode(ctx context.Context, username, code string) error {
+	err := r.update(ctx, username, "DELETE mfa_recovery_codes :codes",
+		"mfa_enabled = :true AND contains(mfa_recovery_codes, :code)",
+		map[string]types.AttributeValue{
+			":codes": &types.AttributeValueMemberSS{Value: []string{code}},
+			":code":  &types.AttributeValueMemberS{Value: code},
+			":true":  &types.AttributeValueMemberBOOL{Value: true},
+		})
+	return onConditionFailed(err, store.ErrConflict)
+}
@@ -0,0 +1,320 @@
+// Package memory implements the repositories of internal/store in memory.
+// It enforces the same conditions as the DynamoDB implementation, so code
+// exercised against it behaves the same once deployed. Nothing expires on
+// its own; callers already check expiry on read, as TTL deletion lags.
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"agendum/internal/store"
+)
+
+// db holds every table behind one lock, which makes the multi-table writes
+// that DynamoDB does in transactions atomic here too
+type db struct {
+	mu            sync.Mutex
+	users         map[string]*store.User
+	emails        map[string]string
+	teams         map[string]*team
+	tasks         map[string]*store.Task
+	sessions      map[string]*store.Session
+	refreshTokens map[string]*store.RefreshToken
+	accessTokens  map[string]*store.AccessToken
+	oneTimeTokens map[string]*store.OneTimeToken
+	loginAttempts map[string]*store.LoginAttempt
+	revokedTokens map[string]int64
+}
+
+// New returns an empty in-memory store
+func New() *store.Store {
+	d := &db{
+		users:         make(map[string]*store.User),
+		emails:        make(map[string]string),
+		teams:         make(map[string]*team),
+		tasks:         make(map[string]*store.Task),
+		sessions:      make(map[string]*store.Session),
+		refreshTokens: make(map[string]*store.RefreshToken),
+		accessTokens:  make(map[string]*store.AccessToken),
+		oneTimeTokens: make(map[string]*store.OneTimeToken),
+		loginAttempts: make(map[string]*store.LoginAttempt),
+		revokedTokens: make(map[string]int64),
+	}
+	return &store.Store{
+		Users:         users{d},
+		Teams:         teams{d},
+		Tasks:         tasks{d},
+		Sessions:      sessions{d},
+		RefreshTokens: refreshTokens{d},
+		AccessTokens:  accessTokens{d},
+		OneTimeTokens: oneTimeTokens{d},
+		LoginAttempts: loginAttempts{d},
+		RevokedTokens: revokedTokens{d},
+	}
+}
+
+type users struct{ *db }
+
+func copyUser(u *store.User) *store.User {
+	c := *u
+	c.TeamIDs = append([]string{}, u.TeamIDs...)
+	c.MFARecoveryCodes = append([]string(nil), u.MFARecoveryCodes...)
+	c.Preferences = copyStrings(u.Preferences)
+	return &c
+}
+
+func copyStrings(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+func (r users) Get(ctx context.Context, username string) (*store.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if u, ok := r.users[username]; ok {
+		return copyUser(u), nil
+	}
+	return nil, nil
+}
+
+func (r users) FindByEmail(ctx context.Context, email string) (*store.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, u := range r.users {
+		if u.Email == email && email != "" {
+			return copyUser(u), nil
+		}
+	}
+	return nil, nil
+}
+
+func (r users) EmailOwner(ctx context.Context, email string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.emails[email], nil
+}
+
+func (r users) Create(ctx context.Context, user *store.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.users[user.Username]; exists {
+		return store.ErrUsernameTaken
+	}
+	if user.Email != "" {
+		if _, exists := r.emails[user.Email]; exists {
+			return store.ErrEmailTaken
+		}
+		r.emails[user.Email] = user.Username
+	}
+	r.users[user.Username] = copyUser(user)
+	return nil
+}
+
+func (r users) CreateServiceAccount(ctx context.Context, user *store.User, role string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.users[user.Username]; exists {
+		return store.ErrUsernameTaken
+	}
+	t, exists := r.teams[user.OwnerTeamID]
+	if !exists {
+		return store.ErrNotFound
+	}
+	if role == "admin" {
+		t.Admins = append(t.Admins, user.Username)
+	} else {
+		t.Members = append(t.Members, user.Username)
+	}
+	r.users[user.Username] = copyUser(user)
+	return nil
+}
+
+func (r users) Delete(ctx context.Context, username string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if u, ok := r.users[username]; ok && r.emails[u.Email] == username {
+		delete(r.emails, u.Email)
+	}
+	delete(r.users, username)
+	return nil
+}
+
+// update applies change to an existing user. change returns
+// store.ErrConflict to leave the user as it was.
+func (r users) update(username string, change func(u *store.User) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	u, ok := r.users[username]
+	if !ok {
+		return store.ErrNotFound
+	}
+	updated := copyUser(u)
+	if err := change(updated); err != nil {
+		return err
+	}
+	r.users[username] = updated
+	return nil
+}
+
+func (r users) UpdateProfile(ctx context.Context, username, firstName, lastName string, preferences map[string]string) error {
+	return r.update(username, func(u *store.User) error {
+		u.FirstName, u.LastName, u.Preferences = firstName, lastName, copyStrings(preferences)
+		return nil
+	})
+}
+
+func (r users) SetPassword(ctx context.Context, username, hash string) error {
+	return r.update(username, func(u *store.User) error {
+		u.Password = hash
+		return nil
+	})
+}
+
+func (r users) ReplacePassword(ctx context.Context, username, oldHash, newHash string) error {
+	err := r.update(username, func(u *store.User) error {
+		if u.Password != oldHash {
+			return store.ErrConflict
+		}
+		u.Password = newHash
+		return nil
+	})
+	if err == store.ErrNotFound {
+		return store.ErrConflict
+	}
+	return err
+}
+
+func (r users) SetUserType(ctx context.Context, username, userType string) error {
+	return r.update(username, func(u *store.User) error {
+		if u.UserType == store.ServiceUserType {
+			return store.ErrNotFound
+		}
+		u.UserType = userType
+		return nil
+	})
+}
+
+func (r users) AddTeam(ctx context.Context, username, teamID string) error {
+	return r.update(username, func(u *store.User) error {
+		u.TeamIDs = append(u.TeamIDs, teamID)
+		return nil
+	})
+}
+
+func (r users) MarkEmailVerified(ctx context.Context, username, email string) error {
+	err := r.update(username, func(u *store.User) error {
+		if u.Email != email {
+			return store.ErrConflict
+		}
+		u.EmailVerified = true
+		return nil
+	})
+	if err == store.ErrNotFound {
+		return store.ErrConflict
+	}
+	return err
+}
+
+func (r users) RecordVerificationSent(ctx context.Context, username string, lastSent, sentAt, windowStart, sends int64) error {
+	err := r.update(username, func(u *store.User) error {
+		if u.VerificationSentAt != lastSent {
+			return store.ErrConflict
+		}
+		u.VerificationSentAt, u.VerificationWindowStart, u.VerificationSends = sentAt, windowStart, sends
+		return nil
+	})
+	if err == store.ErrNotFound {
+		return store.ErrConflict
+	}
+	return err
+}
+
+func (r users) RecordPasswordResetSent(ctx context.Context, username string, lastSent, sentAt, windowStart, sends int64) error {
+	err := r.update(username, func(u *store.User) error {
+		if u.ResetSentAt != lastSent {
+			return store.ErrConflict
+		}
+		u.ResetSentAt, u.ResetWindowStart, u.ResetSends = sentAt, windowStart, sends
+		return nil
+	})
+	if err == store.ErrNotFound {
+		return store.ErrConflict
+	}
+	return err
+}
+
+func (r users) LinkOIDCSubject(ctx context.Context, username, subject string) error {
+	err := r.update(username, func(u *store.User) error {
+		if u.OIDCSubject != "" && u.OIDCSubject != subject {
+			return store.ErrConflict
+		}
+		u.OIDCSubject, u.EmailVerified = subject, true
+		return nil
+	})
+	if err == store.ErrNotFound {
+		return store.ErrConflict
+	}
+	return err
+}
+
+func (r users) SetMFAPendingSecret(ctx context.Context, username, secret string) error {
+	return r.update(username, func(u *store.User) error {
+		u.MFAPendingSecret = secret
+		return nil
+	})
+}
+
+func (r users) EnableMFA(ctx context.Context, username, secret string, recoveryCodes []string, step int64) error {
+	err := r.update(username, func(u *store.User) error {
+		if u.MFAPendingSecret != secret {
+			return store.ErrConflict
+		}
+		u.MFASecret, u.MFAEnabled, u.MFALastStep, u.MFAPendingSecret = secret, true, step, ""
+		u.MFARecoveryCodes = append([]string{}, recoveryCodes...)
+		return nil
+	})
+	if err == store.ErrNotFound {
+		return store.ErrConflict
+	}
+	return err
+}
+
+func (r users) AdvanceMFAStep(ctx context.Context, username string, step int64) error {
+	err := r.update(username, func(u *store.User) error {
+		if u.MFALastStep >= step {
+			return store.ErrConflict
+		}
+		u.MFALastStep = step
+		return nil
+	})
+	if err == store.ErrNotFound {
+		return store.ErrConflict
+	}
+	return err
+}
+
+func (r users) UseRecoveryCode(ctx context.Context, username, code string) error {
+	err := r.update(username, func(u *store.User) error {
+		if !u.MFAEnabled {
+			return store.ErrConflict
+		}
+		for i, c := range u.MFARecoveryCodes {
+			if c == code {
+				u.MFARecoveryCodes = append(u.MFARecoveryCodes[:i], u.MFARecoveryCodes[i+1:]...)
+				return nil
+			}
+		}
+		return store.ErrConflict
+	})
+	if err == store.ErrNotFound {
+		return store.ErrConflict
+	}
+	return err
+}
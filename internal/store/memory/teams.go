@@ -0,0 +1,151 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+
+	"agendum/internal/store"
+)
+
+// team keeps the settings as JSON, which copies them on every read and write
+type team struct {
+	store.Team
+	settings []byte
+}
+
+type teams struct{ *db }
+
+func copyTeam(t *store.Team) *store.Team {
+	c := *t
+	c.Admins = append([]string{}, t.Admins...)
+	c.Members = append([]string{}, t.Members...)
+	return &c
+}
+
+func (r teams) Get(ctx context.Context, teamID string) (*store.Team, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if t, ok := r.teams[teamID]; ok {
+		return copyTeam(&t.Team), nil
+	}
+	return nil, nil
+}
+
+func (r teams) GetMany(ctx context.Context, teamIDs []string) (map[string]*store.Team, map[string]error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	found := make(map[string]*store.Team)
+	for _, teamID := range teamIDs {
+		if t, ok := r.teams[teamID]; ok {
+			found[teamID] = copyTeam(&t.Team)
+		}
+	}
+	return found, map[string]error{}
+}
+
+func (r teams) Create(ctx context.Context, t *store.Team) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.teams[t.TeamID] = &team{Team: *copyTeam(t)}
+	return nil
+}
+
+func (r teams) RemoveUser(ctx context.Context, teamID, username string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, ok := r.teams[teamID]
+	if !ok {
+		return nil, nil
+	}
+	t.Admins = without(t.Admins, username)
+	t.Members = without(t.Members, username)
+	if len(t.Admins) == 0 && len(t.Members) > 0 {
+		t.Admins = []string{t.Members[0]}
+	}
+	return append([]string{}, t.Admins...), nil
+}
+
+func without(users []string, username string) []string {
+	kept := []string{}
+	for _, user := range users {
+		if user != username {
+			kept = append(kept, user)
+		}
+	}
+	return kept
+}
+
+func (r teams) Settings(ctx context.Context, teamID string, settings interface{}) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, ok := r.teams[teamID]
+	if !ok {
+		return false, store.ErrNotFound
+	}
+	if t.settings == nil {
+		return false, nil
+	}
+	return true, json.Unmarshal(t.settings, settings)
+}
+
+func (r teams) SaveSettings(ctx context.Context, teamID string, settings interface{}) error {
+	encoded, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, ok := r.teams[teamID]
+	if !ok {
+		return store.ErrNotFound
+	}
+	t.settings = encoded
+	return nil
+}
+
+type tasks struct{ *db }
+
+func copyTask(t *store.Task) *store.Task {
+	c := *t
+	c.Schedule = make(map[string]store.TimeSlot, len(t.Schedule))
+	for day, slot := range t.Schedule {
+		c.Schedule[day] = slot
+	}
+	return &c
+}
+
+func (r tasks) Create(ctx context.Context, task *store.Task) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tasks[task.TaskID] = copyTask(task)
+	return nil
+}
+
+func (r tasks) ListByRequester(ctx context.Context, username string) ([]store.Task, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var found []store.Task
+	for _, task := range r.tasks {
+		if task.Requester == username {
+			found = append(found, *copyTask(task))
+		}
+	}
+	return found, nil
+}
+
+func (r tasks) SetRequester(ctx context.Context, taskID, username string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if task, ok := r.tasks[taskID]; ok {
+		task.Requester = username
+	}
+	return nil
+}
+
+func (r tasks) Delete(ctx context.Context, taskID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.tasks, taskID)
+	return nil
+}
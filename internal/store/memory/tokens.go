@@ -0,0 +1,310 @@
+package memory
+
+import (
+	"context"
+
+	"agendum/internal/store"
+)
+
+type sessions struct{ *db }
+
+func (r sessions) Put(ctx context.Context, s *store.Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c := *s
+	r.sessions[s.Token] = &c
+	return nil
+}
+
+func (r sessions) Get(ctx context.Context, token string) (*store.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if s, ok := r.sessions[token]; ok {
+		c := *s
+		return &c, nil
+	}
+	return nil, nil
+}
+
+func (r sessions) ListByUser(ctx context.Context, username string) ([]store.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var found []store.Session
+	for _, s := range r.sessions {
+		if s.Username == username {
+			found = append(found, *s)
+		}
+	}
+	return found, nil
+}
+
+func (r sessions) Delete(ctx context.Context, token string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.sessions, token)
+	return nil
+}
+
+func (r sessions) ListWithoutExpiry(ctx context.Context) ([]store.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var found []store.Session
+	for _, s := range r.sessions {
+		if s.ExpiresAtEpoch == 0 {
+			found = append(found, *s)
+		}
+	}
+	return found, nil
+}
+
+func (r sessions) ListUnhashed(ctx context.Context) ([]store.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var found []store.Session
+	for _, s := range r.sessions {
+		if len(s.Token) != store.HashedKeyLength {
+			found = append(found, *s)
+		}
+	}
+	return found, nil
+}
+
+func (r sessions) SetExpiry(ctx context.Context, token string, expiresAtEpoch int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.sessions[token]
+	if !ok {
+		return store.ErrNotFound
+	}
+	s.ExpiresAtEpoch = expiresAtEpoch
+	return nil
+}
+
+type refreshTokens struct{ *db }
+
+func (r refreshTokens) Put(ctx context.Context, rt *store.RefreshToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c := *rt
+	r.refreshTokens[rt.Token] = &c
+	return nil
+}
+
+func (r refreshTokens) Get(ctx context.Context, token string) (*store.RefreshToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if rt, ok := r.refreshTokens[token]; ok {
+		c := *rt
+		return &c, nil
+	}
+	return nil, nil
+}
+
+func (r refreshTokens) ListByUser(ctx context.Context, username string) ([]store.RefreshToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var found []store.RefreshToken
+	for _, rt := range r.refreshTokens {
+		if rt.Username == username {
+			found = append(found, *rt)
+		}
+	}
+	return found, nil
+}
+
+func (r refreshTokens) MarkUsed(ctx context.Context, token string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rt, ok := r.refreshTokens[token]
+	if !ok || rt.Used {
+		return store.ErrConflict
+	}
+	rt.Used = true
+	return nil
+}
+
+func (r refreshTokens) Delete(ctx context.Context, token string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.refreshTokens, token)
+	return nil
+}
+
+func (r refreshTokens) ListUnhashed(ctx context.Context) ([]store.RefreshToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var found []store.RefreshToken
+	for _, rt := range r.refreshTokens {
+		if len(rt.Token) != store.HashedKeyLength {
+			found = append(found, *rt)
+		}
+	}
+	return found, nil
+}
+
+type accessTokens struct{ *db }
+
+func copyAccessToken(at *store.AccessToken) *store.AccessToken {
+	c := *at
+	c.Scopes = append([]string{}, at.Scopes...)
+	return &c
+}
+
+func (r accessTokens) Put(ctx context.Context, at *store.AccessToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.accessTokens[at.Token] = copyAccessToken(at)
+	return nil
+}
+
+func (r accessTokens) Get(ctx context.Context, token string) (*store.AccessToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if at, ok := r.accessTokens[token]; ok {
+		return copyAccessToken(at), nil
+	}
+	return nil, nil
+}
+
+func (r accessTokens) ListByUser(ctx context.Context, username string) ([]store.AccessToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var found []store.AccessToken
+	for _, at := range r.accessTokens {
+		if at.Username == username {
+			found = append(found, *copyAccessToken(at))
+		}
+	}
+	return found, nil
+}
+
+func (r accessTokens) Touch(ctx context.Context, token, lastUsedAt string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if at, ok := r.accessTokens[token]; ok {
+		at.LastUsedAt = lastUsedAt
+	}
+	return nil
+}
+
+func (r accessTokens) Delete(ctx context.Context, token string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.accessTokens, token)
+	return nil
+}
+
+type oneTimeTokens struct{ *db }
+
+func copyOneTimeToken(ott *store.OneTimeToken) *store.OneTimeToken {
+	c := *ott
+	c.Data = copyStrings(ott.Data)
+	return &c
+}
+
+func (r oneTimeTokens) Put(ctx context.Context, ott *store.OneTimeToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.oneTimeTokens[ott.Token] = copyOneTimeToken(ott)
+	return nil
+}
+
+func (r oneTimeTokens) Get(ctx context.Context, token string) (*store.OneTimeToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if ott, ok := r.oneTimeTokens[token]; ok {
+		return copyOneTimeToken(ott), nil
+	}
+	return nil, nil
+}
+
+func (r oneTimeTokens) Consume(ctx context.Context, token, kind string, now int64) (*store.OneTimeToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ott, ok := r.oneTimeTokens[token]
+	if !ok || ott.Kind != kind || ott.ExpiresAtEpoch <= now {
+		return nil, store.ErrNotFound
+	}
+	delete(r.oneTimeTokens, token)
+	return ott, nil
+}
+
+func (r oneTimeTokens) AddAttempt(ctx context.Context, token string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ott, ok := r.oneTimeTokens[token]
+	if !ok {
+		return 0, store.ErrNotFound
+	}
+	ott.Attempts++
+	return ott.Attempts, nil
+}
+
+func (r oneTimeTokens) Delete(ctx context.Context, token string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.oneTimeTokens, token)
+	return nil
+}
+
+type loginAttempts struct{ *db }
+
+func (r loginAttempts) Get(ctx context.Context, key string) (*store.LoginAttempt, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if la, ok := r.loginAttempts[key]; ok {
+		c := *la
+		return &c, nil
+	}
+	return nil, nil
+}
+
+func (r loginAttempts) AddFailure(ctx context.Context, key, failedAt string, expiresAtEpoch int64) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	la, ok := r.loginAttempts[key]
+	if !ok {
+		la = &store.LoginAttempt{Key: key}
+		r.loginAttempts[key] = la
+	}
+	la.Failures++
+	return la.Failures, nil
+}
+
+func (r loginAttempts) Lock(ctx context.Context, key string, lockedUntil int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	la, ok := r.loginAttempts[key]
+	if !ok {
+		la = &store.LoginAttempt{Key: key}
+		r.loginAttempts[key] = la
+	}
+	la.LockedUntil = lockedUntil
+	return nil
+}
+
+func (r loginAttempts) Clear(ctx context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.loginAttempts, key)
+	return nil
+}
+
+type revokedTokens struct{ *db }
+
+func (r revokedTokens) Put(ctx context.Context, key string, revokedAt, expiresAtEpoch int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.revokedTokens[key] = revokedAt
+	return nil
+}
+
+func (r revokedTokens) All(ctx context.Context) (map[string]int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entries := make(map[string]int64, len(r.revokedTokens))
+	for key, revokedAt := range r.revokedTokens {
+		entries[key] = revokedAt
+	}
+	return entries, nil
+}
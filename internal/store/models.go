@@ -0,0 +1,130 @@
+package store
+
+// ServiceUserType is the User.UserType of service accounts, which never
+// changes
+const ServiceUserType = "service"
+
+// User is a row of the Users table
+type User struct {
+	Username string
+	Email    string
+	// Password is the password hash. Accounts created through single
+	// sign-on and service accounts have none.
+	Password    string
+	FirstName   string
+	LastName    string
+	UserType    string
+	TeamIDs     []string
+	Preferences map[string]string
+	// EmailVerified is true for accounts created before email verification
+	// existed, which were never asked to verify
+	EmailVerified bool
+	OIDCSubject   string
+	// OwnerTeamID and CreatedBy are only set for service accounts
+	OwnerTeamID string
+	CreatedBy   string
+
+	MFAEnabled       bool
+	MFASecret        string
+	MFAPendingSecret string
+	// MFARecoveryCodes holds the hashes of the unused recovery codes
+	MFARecoveryCodes []string
+	MFALastStep      int64
+
+	VerificationSentAt      int64
+	VerificationWindowStart int64
+	VerificationSends       int64
+
+	// The password reset counters work like the verification ones
+	ResetSentAt      int64
+	ResetWindowStart int64
+	ResetSends       int64
+}
+
+// Team is a row of the Teams table. Its settings are stored alongside but
+// read and written on their own (see Teams.Settings).
+type Team struct {
+	TeamID           string
+	Name             string
+	CreatedTimestamp string
+	Admins           []string
+	Members          []string
+}
+
+// TimeSlot is a begin/end pair in HH:MM format
+type TimeSlot struct {
+	BeginTime string
+	EndTime   string
+}
+
+// Task is a row of the Tasks table. Schedule is keyed by weekday name.
+type Task struct {
+	TaskID           string
+	Title            string
+	TeamID           string
+	CreatedTimestamp string
+	Schedule         map[string]TimeSlot
+	TaskType         string
+	TimeZone         string
+	Requester        string
+}
+
+// Session is a row of the Sessions table
+type Session struct {
+	// Token is the key: the SHA-256 of the bearer token, or the raw token
+	// for sessions stored before tokens were hashed
+	Token     string
+	SessionID string
+	Username  string
+	CreatedAt string
+	ExpiresAt string
+	UserAgent string
+	// ExpiresAtEpoch is zero for sessions created before it was stored
+	ExpiresAtEpoch int64
+	ReadOnly       bool
+}
+
+// RefreshToken is a row of the RefreshTokens table
+type RefreshToken struct {
+	// Token is the key, hashed like Session.Token
+	Token            string
+	SessionID        string
+	Username         string
+	SessionCreatedAt string
+	UserAgent        string
+	ExpiresAtEpoch   int64
+	Used             bool
+}
+
+// AccessToken is a row of the AccessTokens table
+type AccessToken struct {
+	// Token is the key, the SHA-256 of the token
+	Token          string
+	TokenID        string
+	Username       string
+	Name           string
+	Scopes         []string
+	CreatedBy      string
+	CreatedAt      string
+	LastUsedAt     string
+	ExpiresAtEpoch int64
+}
+
+// OneTimeToken is a row of the OneTimeTokens table
+type OneTimeToken struct {
+	// Token is the key, the SHA-256 of the token
+	Token          string
+	Kind           string
+	Username       string
+	Attempts       int
+	ExpiresAtEpoch int64
+	Data           map[string]string
+}
+
+// LoginAttempt is a row of the LoginAttempts table
+type LoginAttempt struct {
+	Key      string
+	Failures int
+	// LockedUntil is the Unix time the key is locked until, zero if never
+	LockedUntil int64
+}
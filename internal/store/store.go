@@ -0,0 +1,209 @@
+// Package store defines the repositories the API keeps its data in. Handlers
+// and pkg/auth only talk to these interfaces; internal/store/dynamo implements
+// them on DynamoDB and internal/store/memory keeps everything in memory, for
+// tests and local development.
+package store
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	// ErrNotFound is returned when a write needs a row that doesn't exist
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when a conditional write finds the row changed
+	ErrConflict = errors.New("conflicting update")
+	// ErrUsernameTaken is returned when creating a user whose username exists
+	ErrUsernameTaken = errors.New("username is already taken")
+	// ErrEmailTaken is returned when creating a user whose email is reserved
+	ErrEmailTaken = errors.New("email is already taken")
+	// ErrThrottled is returned for reads that were still throttled after
+	// retrying
+	ErrThrottled = errors.New("throttled")
+)
+
+// HashedKeyLength is the length of the hex SHA-256 keys tokens are stored
+// under. Rows with keys of any other length hold a raw token, from before
+// tokens were hashed.
+const HashedKeyLength = 64
+
+// Store groups every repository. Each field can be swapped on its own, so a
+// test can fake a single repository and keep the rest in memory.
+type Store struct {
+	Users         Users
+	Teams         Teams
+	Tasks         Tasks
+	Sessions      Sessions
+	RefreshTokens RefreshTokens
+	AccessTokens  AccessTokens
+	OneTimeTokens OneTimeTokens
+	LoginAttempts LoginAttempts
+	RevokedTokens RevokedTokens
+}
+
+// Users stores accounts, including service accounts, along with the email
+// reservations that keep two accounts from sharing an address
+type Users interface {
+	// Get returns nil when there is no such user
+	Get(ctx context.Context, username string) (*User, error)
+	// FindByEmail returns the user stored with exactly this email, or nil
+	FindByEmail(ctx context.Context, email string) (*User, error)
+	// EmailOwner returns the username that reserved a normalized email, or ""
+	EmailOwner(ctx context.Context, email string) (string, error)
+	// Create adds a user and reserves its email, if it has one, in one step.
+	// It fails with ErrUsernameTaken or ErrEmailTaken.
+	Create(ctx context.Context, user *User) error
+	// CreateServiceAccount adds a service account and puts it on the roster
+	// of user.OwnerTeamID for role, "admin" or "member", in one step. It
+	// fails with ErrUsernameTaken, ErrNotFound when the team doesn't exist
+	// and ErrConflict when the roster changed meanwhile.
+	CreateServiceAccount(ctx context.Context, user *User, role string) error
+	// Delete removes a user and releases its email reservation, unless the
+	// reservation belongs to someone else by now
+	Delete(ctx context.Context, username string) error
+
+	// UpdateProfile fails with ErrNotFound for unknown users
+	UpdateProfile(ctx context.Context, username, firstName, lastName string, preferences map[string]string) error
+	// SetPassword fails with ErrNotFound for unknown users
+	SetPassword(ctx context.Context, username, hash string) error
+	// ReplacePassword swaps oldHash for newHash, failing with ErrConflict
+	// when the stored hash is no longer oldHash
+	ReplacePassword(ctx context.Context, username, oldHash, newHash string) error
+	// SetUserType fails with ErrNotFound for unknown users and service
+	// accounts, whose type never changes
+	SetUserType(ctx context.Context, username, userType string) error
+	// AddTeam appends a team to the user's teams, failing with ErrNotFound
+	// for unknown users
+	AddTeam(ctx context.Context, username, teamID string) error
+	// MarkEmailVerified fails with ErrConflict unless the user's email is
+	// still email
+	MarkEmailVerified(ctx context.Context, username, email string) error
+	// RecordVerificationSent stores the verification email counters,
+	// failing with ErrConflict unless VerificationSentAt is still lastSent
+	RecordVerificationSent(ctx context.Context, username string, lastSent, sentAt, windowStart, sends int64) error
+	// RecordPasswordResetSent does the same for the password reset counters
+	RecordPasswordResetSent(ctx context.Context, username string, lastSent, sentAt, windowStart, sends int64) error
+	// LinkOIDCSubject records the single sign-on identity of an account and
+	// marks its email verified. It fails with ErrConflict when the account
+	// is linked to a different subject.
+	LinkOIDCSubject(ctx context.Context, username, subject string) error
+
+	// SetMFAPendingSecret fails with ErrNotFound for unknown users
+	SetMFAPendingSecret(ctx context.Context, username, secret string) error
+	// EnableMFA turns the pending secret into the active one, failing with
+	// ErrConflict unless the pending secret is still secret
+	EnableMFA(ctx context.Context, username, secret string, recoveryCodes []string, step int64) error
+	// AdvanceMFAStep records the last TOTP step used, failing with
+	// ErrConflict unless step is later than the previous one
+	AdvanceMFAStep(ctx context.Context, username string, step int64) error
+	// UseRecoveryCode removes a recovery code hash, failing with ErrConflict
+	// when two-factor authentication is off or the code isn't left
+	UseRecoveryCode(ctx context.Context, username, code string) error
+}
+
+// Teams stores teams, their rosters and their settings
+type Teams interface {
+	// Get returns nil when there is no such team
+	Get(ctx context.Context, teamID string) (*Team, error)
+	// GetMany loads several teams at once. Teams that don't exist are
+	// missing from both results; failed holds the ones that couldn't be
+	// loaded and why, such as ErrThrottled.
+	GetMany(ctx context.Context, teamIDs []string) (found map[string]*Team, failed map[string]error)
+	Create(ctx context.Context, team *Team) error
+	// RemoveUser drops a user from a team's admins and members and returns
+	// the admins that remain. When it removes the last admin, the first
+	// remaining member becomes admin so the team isn't left without one.
+	// Unknown teams have none. It fails with ErrConflict when the team
+	// keeps changing while it retries.
+	RemoveUser(ctx context.Context, teamID, username string) ([]string, error)
+	// Settings decodes a team's saved settings into settings and reports
+	// whether there were any. It fails with ErrNotFound for unknown teams.
+	Settings(ctx context.Context, teamID string, settings interface{}) (bool, error)
+	// SaveSettings replaces a team's settings, failing with ErrNotFound for
+	// unknown teams
+	SaveSettings(ctx context.Context, teamID string, settings interface{}) error
+}
+
+// Tasks stores the tasks requested of teams
+type Tasks interface {
+	Create(ctx context.Context, task *Task) error
+	ListByRequester(ctx context.Context, username string) ([]Task, error)
+	SetRequester(ctx context.Context, taskID, username string) error
+	Delete(ctx context.Context, taskID string) error
+}
+
+// Sessions stores opaque access tokens by the key of Session.Token
+type Sessions interface {
+	Put(ctx context.Context, session *Session) error
+	// Get returns nil when there is no such session
+	Get(ctx context.Context, token string) (*Session, error)
+	ListByUser(ctx context.Context, username string) ([]Session, error)
+	Delete(ctx context.Context, token string) error
+	// ListWithoutExpiry returns the sessions stored before ExpiresAtEpoch
+	// was, which TTL never deletes
+	ListWithoutExpiry(ctx context.Context) ([]Session, error)
+	// SetExpiry fails with ErrNotFound when the session is gone
+	SetExpiry(ctx context.Context, token string, expiresAtEpoch int64) error
+	// ListUnhashed returns the sessions keyed by a raw token rather than its
+	// hash (see HashedKeyLength)
+	ListUnhashed(ctx context.Context) ([]Session, error)
+}
+
+// RefreshTokens stores refresh tokens by the key of RefreshToken.Token
+type RefreshTokens interface {
+	Put(ctx context.Context, token *RefreshToken) error
+	// Get returns nil when there is no such token
+	Get(ctx context.Context, token string) (*RefreshToken, error)
+	ListByUser(ctx context.Context, username string) ([]RefreshToken, error)
+	// MarkUsed flags a token as used, failing with ErrConflict when it
+	// already was or is gone
+	MarkUsed(ctx context.Context, token string) error
+	Delete(ctx context.Context, token string) error
+	// ListUnhashed returns the tokens keyed by a raw token rather than its
+	// hash (see HashedKeyLength)
+	ListUnhashed(ctx context.Context) ([]RefreshToken, error)
+}
+
+// AccessTokens stores personal access tokens by the key of AccessToken.Token
+type AccessTokens interface {
+	Put(ctx context.Context, token *AccessToken) error
+	// Get returns nil when there is no such token
+	Get(ctx context.Context, token string) (*AccessToken, error)
+	ListByUser(ctx context.Context, username string) ([]AccessToken, error)
+	// Touch records when a token was last used
+	Touch(ctx context.Context, token, lastUsedAt string) error
+	Delete(ctx context.Context, token string) error
+}
+
+// OneTimeTokens stores single-use tokens by the key of OneTimeToken.Token
+type OneTimeTokens interface {
+	Put(ctx context.Context, token *OneTimeToken) error
+	// Get returns nil when there is no such token
+	Get(ctx context.Context, token string) (*OneTimeToken, error)
+	// Consume deletes and returns a token of kind that expires after now.
+	// Only one caller gets it; the others fail with ErrNotFound.
+	Consume(ctx context.Context, token, kind string, now int64) (*OneTimeToken, error)
+	// AddAttempt counts a failed attempt and returns the new count, failing
+	// with ErrNotFound when the token is gone
+	AddAttempt(ctx context.Context, token string) (int, error)
+	Delete(ctx context.Context, token string) error
+}
+
+// LoginAttempts stores failed login counters by account or source IP
+type LoginAttempts interface {
+	// Get returns nil when the key has no failures
+	Get(ctx context.Context, key string) (*LoginAttempt, error)
+	// AddFailure counts a failure at failedAt (RFC 3339), keeps the counter
+	// until expiresAtEpoch and returns the new count
+	AddFailure(ctx context.Context, key, failedAt string, expiresAtEpoch int64) (int, error)
+	Lock(ctx context.Context, key string, lockedUntil int64) error
+	Clear(ctx context.Context, key string) error
+}
+
+// RevokedTokens is the JWT denylist
+type RevokedTokens interface {
+	Put(ctx context.Context, key string, revokedAt, expiresAtEpoch int64) error
+	// All returns every entry with the Unix time it was revoked at
+	All(ctx context.Context) (map[string]int64, error)
+}
@@ -1,66 +1,86 @@
 package auth
 
 import (
-	"os"
-	"strings"
-	"time"
+	"context"
+	"log"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"agendum/internal/store"
 )
 
 // ValidateToken checks if a token is valid and returns the username
-func ValidateToken(token string) (string, bool) {
-	sess := session.Must(session.NewSession())
-	svc := dynamodb.New(sess)
-
-	result, err := svc.GetItem(&dynamodb.GetItemInput{
-		TableName: aws.String(os.Getenv("SESSIONS_TABLE_NAME")),
-		Key: map[string]*dynamodb.AttributeValue{
-			"token": {S: aws.String(token)},
-		},
-	})
-
-	if err != nil || result.Item == nil {
+func ValidateToken(ctx context.Context, db *store.Store, token string) (string, bool) {
+	s, valid := GetSession(ctx, db, token)
+	if !valid {
 		return "", false
 	}
-
-	// Check if token is expired
-	expiresAt := *result.Item["expires_at"].S
-	expireTime, err := time.Parse(time.RFC3339, expiresAt)
-	if err != nil || time.Now().After(expireTime) {
-		return "", false
-	}
-
-	username := *result.Item["username"].S
-	return username, true
+	return s.Username, true
 }
 
 // IsTeamAdmin checks if a user is an admin of a specific team
-func IsTeamAdmin(username, teamID string) bool {
-	sess := session.Must(session.NewSession())
-	svc := dynamodb.New(sess)
+func IsTeamAdmin(ctx context.Context, db *store.Store, username, teamID string) bool {
+	team, err := db.Teams.Get(ctx, teamID)
+	if err != nil || team == nil {
+		return false
+	}
 
-	result, err := svc.GetItem(&dynamodb.GetItemInput{
-		TableName: aws.String(os.Getenv("TEAMS_TABLE_NAME")),
-		Key: map[string]*dynamodb.AttributeValue{
-			"team_id": {S: aws.String(teamID)},
-		},
-	})
+	for _, admin := range team.Admins {
+		if admin == username {
+			return true
+		}
+	}
 
-	if err != nil || result.Item == nil {
+	return false
+}
+
+// IsTeamMember checks if a user is an admin or member of a specific team
+func IsTeamMember(ctx context.Context, db *store.Store, username, teamID string) bool {
+	team, err := db.Teams.Get(ctx, teamID)
+	if err != nil || team == nil {
 		return false
 	}
 
-	adminsStr := *result.Item["admins"].S
-	admins := strings.Split(adminsStr, ",")
-	
-	for _, admin := range admins {
-		if strings.TrimSpace(admin) == username {
-			return true
+	for _, roster := range [][]string{team.Admins, team.Members} {
+		for _, user := range roster {
+			if user == username {
+				return true
+			}
 		}
 	}
-	
+
 	return false
-}
\ No newline at end of file
+}
+
+// IsTeamAdmin checks if the session's user is an admin of a team, using the
+// roles carried by JWT access tokens when there are any. Superadmins pass for
+// every team, and doing so for a team they aren't an admin of is logged.
+func (s *Session) IsTeamAdmin(ctx context.Context, db *store.Store, teamID string) bool {
+	var admin bool
+	if s.TeamRoles != nil {
+		admin = s.TeamRoles[teamID] == "admin"
+	} else {
+		admin = IsTeamAdmin(ctx, db, s.Username, teamID)
+	}
+	if !admin && s.IsSuperadmin() {
+		log.Printf("superadmin %s acting as admin of team %s", s.Username, teamID)
+		return true
+	}
+	return admin
+}
+
+// IsTeamMember checks if the session's user is an admin or member of a team,
+// using the roles carried by JWT access tokens when there are any.
+// Superadmins pass for every team, and doing so for a team they aren't in is
+// logged.
+func (s *Session) IsTeamMember(ctx context.Context, db *store.Store, teamID string) bool {
+	var member bool
+	if s.TeamRoles != nil {
+		_, member = s.TeamRoles[teamID]
+	} else {
+		member = IsTeamMember(ctx, db, s.Username, teamID)
+	}
+	if !member && s.IsSuperadmin() {
+		log.Printf("superadmin %s acting as member of team %s", s.Username, teamID)
+		return true
+	}
+	return member
+}
@@ -0,0 +1,34 @@
+package auth
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// SessionFromAuthorizer rebuilds the session the API Gateway authorizer
+// validated from the request context it attached. Routes behind the
+// authorizer use it instead of reading the Authorization header.
+func SessionFromAuthorizer(authorizer map[string]interface{}) (*Session, bool) {
+	username, _ := authorizer["username"].(string)
+	if username == "" {
+		return nil, false
+	}
+
+	s := &Session{Username: username}
+	s.SessionID, _ = authorizer["session_id"].(string)
+	s.ExpiresAt, _ = authorizer["expires_at"].(string)
+	if expiresAt, err := time.Parse(time.RFC3339, s.ExpiresAt); err == nil {
+		s.ExpiresAtEpoch = expiresAt.Unix()
+	}
+	s.ReadOnly = authorizer["read_only"] == "true"
+	if scopes, ok := authorizer["scopes"].(string); ok {
+		s.Scopes = append([]string{}, strings.Fields(scopes)...)
+	}
+	s.UserType, _ = authorizer["user_type"].(string)
+	if roles, ok := authorizer["team_roles"].(string); ok {
+		json.Unmarshal([]byte(roles), &s.TeamRoles)
+	}
+
+	return s, true
+}
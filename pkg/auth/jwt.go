@@ -0,0 +1,256 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"agendum/internal/store"
+)
+
+// JWTIssuer is the iss claim of access tokens minted by /auth/login
+const JWTIssuer = "agendum"
+
+var (
+	ErrJWTMalformed = errors.New("malformed token")
+	ErrJWTSignature = errors.New("invalid token signature")
+	ErrJWTExpired   = errors.New("token expired")
+	ErrJWTRevoked   = errors.New("token revoked")
+)
+
+// Claims are the contents of a stateless access token. TeamRoles maps each
+// team ID the user belongs to to "admin" or "member" as of when the token
+// was issued.
+type Claims struct {
+	Issuer    string            `json:"iss"`
+	Subject   string            `json:"sub"`
+	ID        string            `json:"jti"`
+	SessionID string            `json:"sid"`
+	IssuedAt  int64             `json:"iat"`
+	ExpiresAt int64             `json:"exp"`
+	TeamRoles map[string]string `json:"teams"`
+	ReadOnly  bool              `json:"ro,omitempty"`
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+	Kid string `json:"kid"`
+}
+
+// SigningKey is one entry of JWT_SIGNING_KEYS. Key is base64: the shared
+// secret for HS256, the 32-byte private key seed for EdDSA.
+type SigningKey struct {
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Key string `json:"key"`
+
+	secret     []byte
+	privateKey ed25519.PrivateKey
+}
+
+// JWTMode reports whether /auth/login should issue signed JWT access tokens
+// instead of Sessions table tokens (AUTH_TOKEN_MODE=jwt)
+func JWTMode() bool {
+	return os.Getenv("AUTH_TOKEN_MODE") == "jwt"
+}
+
+// signingKeys parses JWT_SIGNING_KEYS, a JSON array of SigningKey. Keeping
+// retired keys in the list lets tokens they signed verify until they expire;
+// JWT_SIGNING_KID picks the key new tokens are signed with.
+func signingKeys() (map[string]*SigningKey, error) {
+	raw := os.Getenv("JWT_SIGNING_KEYS")
+	if raw == "" {
+		return nil, errors.New("JWT_SIGNING_KEYS is not configured")
+	}
+
+	var list []*SigningKey
+	if err := json.Unmarshal([]byte(raw), &list); err != nil {
+		return nil, errors.New("JWT_SIGNING_KEYS must be a JSON array of {kid, alg, key}")
+	}
+
+	keys := make(map[string]*SigningKey)
+	for _, k := range list {
+		decoded, err := base64.StdEncoding.DecodeString(k.Key)
+		if err != nil || k.Kid == "" {
+			return nil, errors.New("JWT_SIGNING_KEYS entries need a kid and a base64 key")
+		}
+		switch k.Alg {
+		case "HS256":
+			if len(decoded) < 32 {
+				return nil, errors.New("HS256 keys must be at least 32 bytes")
+			}
+			k.secret = decoded
+		case "EdDSA":
+			if len(decoded) != ed25519.SeedSize {
+				return nil, errors.New("EdDSA keys must be a 32-byte seed")
+			}
+			k.privateKey = ed25519.NewKeyFromSeed(decoded)
+		default:
+			return nil, errors.New("unsupported JWT algorithm " + k.Alg)
+		}
+		keys[k.Kid] = k
+	}
+	return keys, nil
+}
+
+func (k *SigningKey) sign(input []byte) []byte {
+	if k.Alg == "EdDSA" {
+		return ed25519.Sign(k.privateKey, input)
+	}
+	mac := hmac.New(sha256.New, k.secret)
+	mac.Write(input)
+	return mac.Sum(nil)
+}
+
+func (k *SigningKey) verify(input, signature []byte) bool {
+	if k.Alg == "EdDSA" {
+		return ed25519.Verify(k.privateKey.Public().(ed25519.PublicKey), input, signature)
+	}
+	return hmac.Equal(k.sign(input), signature)
+}
+
+// IssueJWT signs the claims with the key named by JWT_SIGNING_KID
+func IssueJWT(claims Claims) (string, error) {
+	keys, err := signingKeys()
+	if err != nil {
+		return "", err
+	}
+	key, ok := keys[os.Getenv("JWT_SIGNING_KID")]
+	if !ok {
+		return "", errors.New("JWT_SIGNING_KID does not name a key in JWT_SIGNING_KEYS")
+	}
+
+	header, _ := json.Marshal(jwtHeader{Alg: key.Alg, Typ: "JWT", Kid: key.Kid})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return input + "." + base64.RawURLEncoding.EncodeToString(key.sign([]byte(input))), nil
+}
+
+// IsJWT tells signed access tokens apart from opaque session tokens
+func IsJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// ParseJWT verifies a token's signature, expiry and revocation status and
+// returns its claims
+func ParseJWT(ctx context.Context, db *store.Store, token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrJWTMalformed
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrJWTMalformed
+	}
+
+	keys, err := signingKeys()
+	if err != nil {
+		return nil, err
+	}
+	key, ok := keys[header.Kid]
+	// The algorithm comes from our key, never from the token header
+	if !ok || header.Alg != key.Alg {
+		return nil, ErrJWTSignature
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !key.verify([]byte(parts[0]+"."+parts[1]), signature) {
+		return nil, ErrJWTSignature
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrJWTMalformed
+	}
+	if claims.Issuer != JWTIssuer || claims.Subject == "" {
+		return nil, ErrJWTMalformed
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, ErrJWTExpired
+	}
+	revoked, err := jwtDenylist.revoked(ctx, db, &claims)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrJWTRevoked
+	}
+
+	return &claims, nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// denylist caches the RevokedTokens table so validating a JWT doesn't cost a
+// DynamoDB read; revocations take up to denylistRefresh to apply everywhere.
+// Until the table has been loaded once, every token is refused rather than
+// let through unchecked.
+type denylist struct {
+	mu       sync.Mutex
+	loadedAt time.Time
+	entries  map[string]int64
+}
+
+const denylistRefresh = 30 * time.Second
+
+var jwtDenylist = &denylist{}
+
+func (d *denylist) revoked(ctx context.Context, db *store.Store, claims *Claims) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if time.Since(d.loadedAt) > denylistRefresh {
+		entries, err := db.RevokedTokens.All(ctx)
+		if err != nil && d.loadedAt.IsZero() {
+			return false, fmt.Errorf("loading revoked tokens: %w", err)
+		}
+		// Otherwise a failed refresh keeps the entries from the last load
+		// and is retried on the next token
+		if err == nil {
+			d.entries = entries
+			d.loadedAt = time.Now()
+		}
+	}
+
+	if _, ok := d.entries["jti#"+claims.ID]; ok {
+		return true, nil
+	}
+	if _, ok := d.entries["sid#"+claims.SessionID]; ok && claims.SessionID != "" {
+		return true, nil
+	}
+	// A user entry revokes every token issued up to the time it was written
+	if revokedAt, ok := d.entries["user#"+claims.Subject]; ok && claims.IssuedAt <= revokedAt {
+		return true, nil
+	}
+	return false, nil
+}
+
+func (d *denylist) add(key string, value int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.entries == nil {
+		d.entries = make(map[string]int64)
+	}
+	d.entries[key] = value
+}
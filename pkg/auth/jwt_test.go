@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"agendum/internal/store"
+	"agendum/internal/store/memory"
+)
+
+var (
+	hsSecret = []byte(strings.Repeat("s", 32))
+	edSeed   = []byte(strings.Repeat("e", ed25519.SeedSize))
+)
+
+// setupJWT configures an HS256 key "hs" and an EdDSA key "ed", signing with
+// kid, and starts from an empty denylist
+func setupJWT(t *testing.T, kid string) *store.Store {
+	t.Helper()
+	keys, _ := json.Marshal([]SigningKey{
+		{Kid: "hs", Alg: "HS256", Key: base64.StdEncoding.EncodeToString(hsSecret)},
+		{Kid: "ed", Alg: "EdDSA", Key: base64.StdEncoding.EncodeToString(edSeed)},
+	})
+	t.Setenv("JWT_SIGNING_KEYS", string(keys))
+	t.Setenv("JWT_SIGNING_KID", kid)
+	jwtDenylist = &denylist{}
+	return memory.New()
+}
+
+func testClaims() Claims {
+	now := time.Now()
+	return Claims{
+		Issuer:    JWTIssuer,
+		Subject:   "alice",
+		ID:        "jti-1",
+		SessionID: "session-1",
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(time.Hour).Unix(),
+	}
+}
+
+// forge signs claims under any header, the way an attacker could
+func forge(t *testing.T, header jwtHeader, claims Claims, key *SigningKey) string {
+	t.Helper()
+	encodedHeader, _ := json.Marshal(header)
+	payload, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(encodedHeader) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return input + "." + base64.RawURLEncoding.EncodeToString(key.sign([]byte(input)))
+}
+
+func TestJWTSignAndVerify(t *testing.T) {
+	for _, kid := range []string{"hs", "ed"} {
+		db := setupJWT(t, kid)
+		claims := testClaims()
+		claims.TeamRoles = map[string]string{"team-1": "admin"}
+
+		token, err := IssueJWT(claims)
+		if err != nil {
+			t.Fatalf("%s: %v", kid, err)
+		}
+		if !IsJWT(token) {
+			t.Errorf("%s: %q isn't recognized as a JWT", kid, token)
+		}
+		parsed, err := ParseJWT(context.Background(), db, token)
+		if err != nil {
+			t.Fatalf("%s: %v", kid, err)
+		}
+		if parsed.Subject != "alice" || parsed.TeamRoles["team-1"] != "admin" {
+			t.Errorf("%s: got claims %+v", kid, parsed)
+		}
+	}
+}
+
+func TestJWTRejected(t *testing.T) {
+	db := setupJWT(t, "hs")
+	hs := &SigningKey{Alg: "HS256", secret: hsSecret}
+	// Whoever knows the EdDSA public key could use it as an HMAC secret
+	edPublic := ed25519.NewKeyFromSeed(edSeed).Public().(ed25519.PublicKey)
+	hsWithEdPublic := &SigningKey{Alg: "HS256", secret: edPublic}
+
+	expired := testClaims()
+	expired.ExpiresAt = time.Now().Add(-time.Minute).Unix()
+	otherIssuer := testClaims()
+	otherIssuer.Issuer = "someone-else"
+
+	valid, _ := IssueJWT(testClaims())
+	parts := strings.Split(valid, ".")
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"HS256 token against an EdDSA kid", forge(t, jwtHeader{Alg: "HS256", Kid: "ed"}, testClaims(), hsWithEdPublic), ErrJWTSignature},
+		{"alg none", forge(t, jwtHeader{Alg: "none", Kid: "hs"}, testClaims(), hs), ErrJWTSignature},
+		{"unknown kid", forge(t, jwtHeader{Alg: "HS256", Kid: "retired"}, testClaims(), hs), ErrJWTSignature},
+		{"tampered payload", parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"iss":"agendum","sub":"mallory"}`)) + "." + parts[2], ErrJWTSignature},
+		{"expired", forge(t, jwtHeader{Alg: "HS256", Kid: "hs"}, expired, hs), ErrJWTExpired},
+		{"other issuer", forge(t, jwtHeader{Alg: "HS256", Kid: "hs"}, otherIssuer, hs), ErrJWTMalformed},
+		{"not a JWT", "a.b", ErrJWTMalformed},
+	}
+	for _, test := range tests {
+		if _, err := ParseJWT(context.Background(), db, test.token); err != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.want)
+		}
+	}
+}
+
+func TestJWTDenylist(t *testing.T) {
+	ctx := context.Background()
+	past := time.Now().Add(-time.Minute).Unix()
+
+	tests := []struct {
+		name   string
+		key    string
+		at     int64
+		claims func(*Claims)
+		denied bool
+	}{
+		{"token ID", "jti#jti-1", past, nil, true},
+		{"session", "sid#session-1", past, nil, true},
+		{"user, token issued before", "user#alice", past, func(c *Claims) { c.IssuedAt = past - 60 }, true},
+		{"user, token issued after", "user#alice", past, nil, false},
+		{"another session", "sid#session-2", past, nil, false},
+	}
+	for _, test := range tests {
+		db := setupJWT(t, "hs")
+		if err := db.RevokedTokens.Put(ctx, test.key, test.at, time.Now().Add(time.Hour).Unix()); err != nil {
+			t.Fatal(err)
+		}
+		claims := testClaims()
+		if test.claims != nil {
+			test.claims(&claims)
+		}
+		token, _ := IssueJWT(claims)
+
+		_, err := ParseJWT(ctx, db, token)
+		if denied := err == ErrJWTRevoked; denied != test.denied {
+			t.Errorf("%s: got %v, want denied %v", test.name, err, test.denied)
+		}
+	}
+}
+
+// unavailableRevokedTokens fails every read, like an unreachable table
+type unavailableRevokedTokens struct{}
+
+var errUnavailable = errors.New("table unavailable")
+
+func (unavailableRevokedTokens) Put(ctx context.Context, key string, revokedAt, expiresAtEpoch int64) error {
+	return errUnavailable
+}
+
+func (unavailableRevokedTokens) All(ctx context.Context) (map[string]int64, error) {
+	return nil, errUnavailable
+}
+
+func TestJWTDenylistFailsClosed(t *testing.T) {
+	db := setupJWT(t, "hs")
+	db.RevokedTokens = unavailableRevokedTokens{}
+	token, _ := IssueJWT(testClaims())
+
+	if _, err := ParseJWT(context.Background(), db, token); !errors.Is(err, errUnavailable) {
+		t.Errorf("denylist never loaded: got %v, want the load error", err)
+	}
+}
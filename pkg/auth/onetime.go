@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"time"
+
+	"agendum/internal/store"
+)
+
+// Kinds of one-time tokens; a token is only accepted for the kind it was
+// issued as
+const (
+	OneTimeMFAChallenge  = "mfa_challenge"
+	OneTimePasswordReset = "password_reset"
+	OneTimeOIDCState     = "oidc_state"
+)
+
+// OneTimeToken is a row of the OneTimeTokens table: a short-lived, single-use
+// token standing in for a user between two steps of a flow. Its Data is
+// whatever else the flow needs to carry between its steps.
+type OneTimeToken = store.OneTimeToken
+
+// IssueOneTimeToken stores the hash of a new one-time token and returns the
+// token itself
+func IssueOneTimeToken(ctx context.Context, db *store.Store, kind, username string, ttl time.Duration) (string, error) {
+	return IssueOneTimeTokenWithData(ctx, db, kind, username, ttl, nil)
+}
+
+// IssueOneTimeTokenWithData is IssueOneTimeToken for flows that keep extra
+// values with the token
+func IssueOneTimeTokenWithData(ctx context.Context, db *store.Store, kind, username string, ttl time.Duration, data map[string]string) (string, error) {
+	raw := make([]byte, 32)
+	rand.Read(raw)
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	err := db.OneTimeTokens.Put(ctx, &store.OneTimeToken{
+		Token:          HashToken(token),
+		Kind:           kind,
+		Username:       username,
+		ExpiresAtEpoch: time.Now().Add(ttl).Unix(),
+		Data:           data,
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// GetOneTimeToken returns an unexpired token of the given kind without
+// using it up
+func GetOneTimeToken(ctx context.Context, db *store.Store, kind, token string) (*OneTimeToken, bool) {
+	ott, err := db.OneTimeTokens.Get(ctx, HashToken(token))
+	if err != nil || ott == nil {
+		return nil, false
+	}
+	if ott.Kind != kind || time.Now().Unix() >= ott.ExpiresAtEpoch {
+		return nil, false
+	}
+	return ott, true
+}
+
+// ConsumeOneTimeToken deletes a token of the given kind and returns it. Only
+// one caller can consume a token; everyone else gets false.
+func ConsumeOneTimeToken(ctx context.Context, db *store.Store, kind, token string) (*OneTimeToken, bool, error) {
+	ott, err := db.OneTimeTokens.Consume(ctx, HashToken(token), kind, time.Now().Unix())
+	if err == store.ErrNotFound {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return ott, true, nil
+}
+
+// RecordOneTimeTokenFailure counts a wrong answer given with a token and
+// deletes the token once maxAttempts is reached
+func RecordOneTimeTokenFailure(ctx context.Context, db *store.Store, token string, maxAttempts int) error {
+	attempts, err := db.OneTimeTokens.AddAttempt(ctx, HashToken(token))
+	if err == store.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if attempts < maxAttempts {
+		return nil
+	}
+	return db.OneTimeTokens.Delete(ctx, HashToken(token))
+}
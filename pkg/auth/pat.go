@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+	"time"
+
+	"agendum/internal/store"
+	"agendum/pkg/utils"
+)
+
+// PATPrefix starts every personal access token, which tells them apart from
+// session tokens and makes leaked ones easy to spot
+const PATPrefix = "agp_"
+
+// Scopes a personal access token can be granted. There is no read:tasks
+// until the API has routes that read tasks.
+const (
+	ScopeWriteTasks  = "write:tasks"
+	ScopeManageTeams = "manage:teams"
+)
+
+// Scopes lists every valid scope
+var Scopes = []string{ScopeWriteTasks, ScopeManageTeams}
+
+// ValidScope reports whether scope is one of Scopes
+func ValidScope(scope string) bool {
+	for _, s := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// AccessToken is a row of the AccessTokens table. Only the hash of the token
+// is stored, under the same scheme as session tokens.
+type AccessToken struct {
+	TokenID        string   `json:"token_id"`
+	Username       string   `json:"username"`
+	Name           string   `json:"name"`
+	Scopes         []string `json:"scopes"`
+	CreatedBy      string   `json:"created_by"`
+	CreatedAt      string   `json:"created_at"`
+	ExpiresAt      string   `json:"expires_at"`
+	LastUsedAt     string   `json:"last_used_at,omitempty"`
+	ExpiresAtEpoch int64    `json:"-"`
+	key            string
+}
+
+func accessTokenFromStored(stored store.AccessToken) AccessToken {
+	return AccessToken{
+		TokenID:        stored.TokenID,
+		Username:       stored.Username,
+		Name:           stored.Name,
+		Scopes:         append([]string{}, stored.Scopes...),
+		CreatedBy:      stored.CreatedBy,
+		CreatedAt:      stored.CreatedAt,
+		ExpiresAt:      time.Unix(stored.ExpiresAtEpoch, 0).UTC().Format(time.RFC3339),
+		LastUsedAt:     stored.LastUsedAt,
+		ExpiresAtEpoch: stored.ExpiresAtEpoch,
+		key:            stored.Token,
+	}
+}
+
+// IssueAccessToken creates a personal access token for username, which may be
+// a service account, and returns the token itself along with its record
+func IssueAccessToken(ctx context.Context, db *store.Store, username, name string, scopes []string, ttl time.Duration, createdBy string) (string, *AccessToken, error) {
+	raw := make([]byte, 32)
+	rand.Read(raw)
+	token := PATPrefix + base64.RawURLEncoding.EncodeToString(raw)
+
+	now := time.Now()
+	stored := store.AccessToken{
+		Token:          HashToken(token),
+		TokenID:        utils.GenerateID(),
+		Username:       username,
+		Name:           name,
+		Scopes:         scopes,
+		CreatedBy:      createdBy,
+		CreatedAt:      now.Format(time.RFC3339),
+		ExpiresAtEpoch: now.Add(ttl).Unix(),
+	}
+	if err := db.AccessTokens.Put(ctx, &stored); err != nil {
+		return "", nil, err
+	}
+
+	at := accessTokenFromStored(stored)
+	return token, &at, nil
+}
+
+// getAccessTokenSession validates a personal access token for GetSession and
+// records when it was last used
+func getAccessTokenSession(ctx context.Context, db *store.Store, token string) (*Session, bool) {
+	stored, err := db.AccessTokens.Get(ctx, HashToken(token))
+	if err != nil || stored == nil {
+		return nil, false
+	}
+
+	at := accessTokenFromStored(*stored)
+	if time.Now().Unix() >= at.ExpiresAtEpoch {
+		return nil, false
+	}
+
+	// Best effort: a failed update shouldn't reject a valid token
+	db.AccessTokens.Touch(ctx, at.key, time.Now().Format(time.RFC3339))
+
+	return &Session{
+		Token:          at.key,
+		SessionID:      "pat-" + at.TokenID,
+		Username:       at.Username,
+		CreatedAt:      at.CreatedAt,
+		ExpiresAt:      at.ExpiresAt,
+		ExpiresAtEpoch: at.ExpiresAtEpoch,
+		Scopes:         at.Scopes,
+	}, true
+}
+
+// ListAccessTokens returns a user's personal access tokens that haven't expired
+func ListAccessTokens(ctx context.Context, db *store.Store, username string) ([]AccessToken, error) {
+	tokens, err := db.AccessTokens.ListByUser(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+
+	active := []AccessToken{}
+	for _, at := range tokens {
+		if time.Now().Unix() < at.ExpiresAtEpoch {
+			active = append(active, accessTokenFromStored(at))
+		}
+	}
+	return active, nil
+}
+
+// RevokeAccessToken deletes one of a user's personal access tokens and
+// reports whether it existed
+func RevokeAccessToken(ctx context.Context, db *store.Store, username, tokenID string) (bool, error) {
+	return revokeAccessTokens(ctx, db, username, func(at store.AccessToken) bool { return at.TokenID == tokenID })
+}
+
+// RevokeUserAccessTokens deletes every personal access token of a user
+func RevokeUserAccessTokens(ctx context.Context, db *store.Store, username string) error {
+	_, err := revokeAccessTokens(ctx, db, username, func(store.AccessToken) bool { return true })
+	return err
+}
+
+func revokeAccessTokens(ctx context.Context, db *store.Store, username string, match func(store.AccessToken) bool) (bool, error) {
+	tokens, err := db.AccessTokens.ListByUser(ctx, username)
+	if err != nil {
+		return false, err
+	}
+
+	found := false
+	for _, at := range tokens {
+		if !match(at) {
+			continue
+		}
+		found = true
+		if err := db.AccessTokens.Delete(ctx, at.Token); err != nil {
+			return false, err
+		}
+	}
+	return found, nil
+}
+
+// IsAccessToken tells personal access tokens apart from session tokens
+func IsAccessToken(token string) bool {
+	return strings.HasPrefix(token, PATPrefix)
+}
@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"agendum/internal/store"
+)
+
+// RefreshToken is a row of the RefreshTokens table. Every refresh token
+// issued for the same login shares its SessionID, which is how a whole
+// family is revoked when a used token is presented again.
+type RefreshToken store.RefreshToken
+
+func (rt RefreshToken) expired() bool {
+	return time.Now().Unix() >= rt.ExpiresAtEpoch
+}
+
+// GetRefreshToken returns a refresh token that hasn't expired, used or not
+func GetRefreshToken(ctx context.Context, db *store.Store, token string) (*RefreshToken, bool) {
+	for _, key := range tokenKeys(token) {
+		stored, err := db.RefreshTokens.Get(ctx, key)
+		if err != nil {
+			return nil, false
+		}
+		if stored == nil {
+			continue
+		}
+
+		rt := RefreshToken(*stored)
+		if rt.expired() {
+			return nil, false
+		}
+		return &rt, true
+	}
+	return nil, false
+}
+
+// MarkRefreshTokenUsed atomically flags a refresh token as used, given the
+// stored key from GetRefreshToken. It returns false when the token had
+// already been used, which means it was replayed.
+func MarkRefreshTokenUsed(ctx context.Context, db *store.Store, key string) (bool, error) {
+	err := db.RefreshTokens.MarkUsed(ctx, key)
+	if err == store.ErrConflict {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
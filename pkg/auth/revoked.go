@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"agendum/internal/store"
+)
+
+// revocationRetention is how long a denylist entry is kept. JWT access
+// tokens must not live longer than this or revoked ones would come back.
+const revocationRetention = 24 * time.Hour
+
+// CheckAccessTokenTTL fails when JWT access tokens would outlive the
+// denylist entries that revoke them
+func CheckAccessTokenTTL(ttl time.Duration) error {
+	if JWTMode() && ttl > revocationRetention {
+		return fmt.Errorf("ACCESS_TOKEN_TTL of %s is longer than the %s revoked JWTs are remembered", ttl, revocationRetention)
+	}
+	return nil
+}
+
+// denyJWTSession denylists every JWT issued for a session
+func denyJWTSession(ctx context.Context, db *store.Store, sessionID string) error {
+	return denyJWT(ctx, db, "sid#"+sessionID)
+}
+
+// denyJWTUser denylists every JWT issued to a user until now
+func denyJWTUser(ctx context.Context, db *store.Store, username string) error {
+	return denyJWT(ctx, db, "user#"+username)
+}
+
+func denyJWT(ctx context.Context, db *store.Store, key string) error {
+	now := time.Now()
+	if err := db.RevokedTokens.Put(ctx, key, now.Unix(), now.Add(revocationRetention).Unix()); err != nil {
+		return err
+	}
+
+	// Apply to this container right away instead of waiting for the next refresh
+	jwtDenylist.add(key, now.Unix())
+	return nil
+}
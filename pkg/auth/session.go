@@ -0,0 +1,303 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"agendum/internal/store"
+)
+
+// Session is a row of the Sessions table
+type Session struct {
+	// Token is the table key: the SHA-256 of the bearer token, or the raw
+	// token for sessions created before tokens were hashed
+	Token     string
+	SessionID string
+	Username  string
+	CreatedAt string
+	ExpiresAt string
+	UserAgent string
+	// ExpiresAtEpoch is zero for sessions created before it was stored
+	ExpiresAtEpoch int64
+	// ReadOnly sessions belong to users who haven't verified their email yet
+	// and may only make GET requests (see UnverifiedReadOnly)
+	ReadOnly bool
+	// Scopes limits what a personal access token may do. It is nil for
+	// sessions from logging in, which may do anything the user can.
+	Scopes []string
+	// TeamRoles is only set for JWT access tokens, which carry the user's
+	// team roles so checking them doesn't need a Teams table read
+	TeamRoles map[string]string
+	// UserType is the user's effective platform role, set by the API
+	// Gateway authorizer (see SessionFromAuthorizer). Personal access tokens
+	// never carry one.
+	UserType string
+}
+
+func sessionFromStored(stored store.Session) Session {
+	s := Session{
+		Token:          stored.Token,
+		SessionID:      stored.SessionID,
+		Username:       stored.Username,
+		CreatedAt:      stored.CreatedAt,
+		ExpiresAt:      stored.ExpiresAt,
+		UserAgent:      stored.UserAgent,
+		ExpiresAtEpoch: stored.ExpiresAtEpoch,
+		ReadOnly:       stored.ReadOnly,
+	}
+
+	// Sessions created before session IDs existed get a stable ID derived
+	// from the token, so they can still be listed and revoked individually
+	if s.SessionID == "" {
+		s.SessionID = "legacy-" + HashToken(s.Token)[:12]
+	}
+
+	return s
+}
+
+// HashToken returns the key a token is stored under. Only the hash is kept
+// at rest, so reading the table or a backup doesn't reveal usable tokens.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// tokenKeys returns the keys a presented token may be stored under: its
+// hash, then the raw token for rows from before tokens were hashed. A token
+// that looks like a hash is only looked up by its hash, since no issued
+// token does and otherwise anyone who could read a table could present its
+// keys as tokens.
+//
+// TODO: drop the raw key once every stage has run 24 hours on hashed tokens
+// and cmd/expire-plaintext-tokens has cleaned up what's left.
+func tokenKeys(token string) []string {
+	if isHexHash(token) {
+		return []string{HashToken(token)}
+	}
+	return []string{HashToken(token), token}
+}
+
+func isHexHash(token string) bool {
+	if len(token) != store.HashedKeyLength {
+		return false
+	}
+	_, err := hex.DecodeString(token)
+	return err == nil
+}
+
+// HasScope reports whether the session may act within scope
+func (s *Session) HasScope(scope string) bool {
+	if s.Scopes == nil {
+		return true
+	}
+	for _, granted := range s.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// expired is still checked on read because TTL deletion can lag expiry by hours
+func (s Session) expired() bool {
+	if s.ExpiresAtEpoch > 0 {
+		return time.Now().Unix() >= s.ExpiresAtEpoch
+	}
+	expireTime, err := time.Parse(time.RFC3339, s.ExpiresAt)
+	return err != nil || time.Now().After(expireTime)
+}
+
+// GetSession returns the session for a token if it exists and hasn't expired.
+// JWT access tokens are verified locally instead of looked up; personal
+// access tokens come from the AccessTokens table.
+func GetSession(ctx context.Context, db *store.Store, token string) (*Session, bool) {
+	if IsAccessToken(token) {
+		return getAccessTokenSession(ctx, db, token)
+	}
+	if IsJWT(token) {
+		claims, err := ParseJWT(ctx, db, token)
+		if err != nil {
+			return nil, false
+		}
+		return &Session{
+			Token:          token,
+			SessionID:      claims.SessionID,
+			Username:       claims.Subject,
+			ExpiresAt:      time.Unix(claims.ExpiresAt, 0).UTC().Format(time.RFC3339),
+			ExpiresAtEpoch: claims.ExpiresAt,
+			ReadOnly:       claims.ReadOnly,
+			TeamRoles:      claims.TeamRoles,
+		}, true
+	}
+
+	for _, key := range tokenKeys(token) {
+		stored, err := db.Sessions.Get(ctx, key)
+		if err != nil {
+			return nil, false
+		}
+		if stored == nil {
+			continue
+		}
+
+		s := sessionFromStored(*stored)
+		if s.expired() {
+			return nil, false
+		}
+		return &s, true
+	}
+	return nil, false
+}
+
+// ListUserSessions returns a user's sessions that haven't expired. A session
+// stays listed while either its access token or an unused refresh token is
+// still valid.
+func ListUserSessions(ctx context.Context, db *store.Store, username string) ([]Session, error) {
+	sessions, err := queryUserSessions(ctx, db, username)
+	if err != nil {
+		return nil, err
+	}
+	refreshTokens, err := db.RefreshTokens.ListByUser(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]*Session)
+	var order []string
+	add := func(s Session) {
+		existing, ok := byID[s.SessionID]
+		if !ok {
+			byID[s.SessionID] = &s
+			order = append(order, s.SessionID)
+			return
+		}
+		if s.ExpiresAtEpoch > existing.ExpiresAtEpoch {
+			existing.ExpiresAt = s.ExpiresAt
+			existing.ExpiresAtEpoch = s.ExpiresAtEpoch
+		}
+	}
+
+	for _, s := range sessions {
+		if !s.expired() {
+			add(s)
+		}
+	}
+	for _, rt := range refreshTokens {
+		if rt.Used || RefreshToken(rt).expired() {
+			continue
+		}
+		add(Session{
+			SessionID:      rt.SessionID,
+			Username:       rt.Username,
+			CreatedAt:      rt.SessionCreatedAt,
+			ExpiresAt:      time.Unix(rt.ExpiresAtEpoch, 0).UTC().Format(time.RFC3339),
+			ExpiresAtEpoch: rt.ExpiresAtEpoch,
+			UserAgent:      rt.UserAgent,
+		})
+	}
+
+	active := []Session{}
+	for _, id := range order {
+		active = append(active, *byID[id])
+	}
+	return active, nil
+}
+
+// RevokeSession deletes the access and refresh tokens of one of a user's
+// sessions and reports whether the session existed
+func RevokeSession(ctx context.Context, db *store.Store, username, sessionID string) (bool, error) {
+	// Only deny a session's JWTs once it's known to be the user's, or anyone
+	// could revoke other users' sessions by ID
+	sessions, err := ListUserSessions(ctx, db, username)
+	if err != nil {
+		return false, err
+	}
+	owned := false
+	for _, s := range sessions {
+		if s.SessionID == sessionID {
+			owned = true
+			break
+		}
+	}
+	if !owned {
+		return false, nil
+	}
+
+	if err := denyJWTSession(ctx, db, sessionID); err != nil {
+		return false, err
+	}
+	return revokeSessions(ctx, db, username, func(id string) bool { return id == sessionID })
+}
+
+// RevokeUserSessions deletes every session belonging to a user
+func RevokeUserSessions(ctx context.Context, db *store.Store, username string) error {
+	if err := denyJWTUser(ctx, db, username); err != nil {
+		return err
+	}
+	_, err := revokeSessions(ctx, db, username, func(string) bool { return true })
+	return err
+}
+
+// RevokeOtherSessions deletes every session of a user except the one with
+// keepSessionID, such as the session that just changed the password
+func RevokeOtherSessions(ctx context.Context, db *store.Store, username, keepSessionID string) error {
+	sessions, err := ListUserSessions(ctx, db, username)
+	if err != nil {
+		return err
+	}
+	for _, s := range sessions {
+		if s.SessionID == keepSessionID {
+			continue
+		}
+		if err := denyJWTSession(ctx, db, s.SessionID); err != nil {
+			return err
+		}
+	}
+	_, err = revokeSessions(ctx, db, username, func(id string) bool { return id != keepSessionID })
+	return err
+}
+
+func revokeSessions(ctx context.Context, db *store.Store, username string, match func(sessionID string) bool) (bool, error) {
+	sessions, err := queryUserSessions(ctx, db, username)
+	if err != nil {
+		return false, err
+	}
+	refreshTokens, err := db.RefreshTokens.ListByUser(ctx, username)
+	if err != nil {
+		return false, err
+	}
+
+	found := false
+	for _, s := range sessions {
+		if !match(s.SessionID) {
+			continue
+		}
+		found = true
+		if err := db.Sessions.Delete(ctx, s.Token); err != nil {
+			return false, err
+		}
+	}
+	for _, rt := range refreshTokens {
+		if !match(rt.SessionID) {
+			continue
+		}
+		found = true
+		if err := db.RefreshTokens.Delete(ctx, rt.Token); err != nil {
+			return false, err
+		}
+	}
+	return found, nil
+}
+
+func queryUserSessions(ctx context.Context, db *store.Store, username string) ([]Session, error) {
+	stored, err := db.Sessions.ListByUser(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	sessions := make([]Session, len(stored))
+	for i, s := range stored {
+		sessions[i] = sessionFromStored(s)
+	}
+	return sessions, nil
+}
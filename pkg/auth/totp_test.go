@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Key is the SHA-1 secret of the RFC 6238 test vectors
+var rfc6238Key = []byte("12345678901234567890")
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B, truncated to 6 digits
+	tests := []struct {
+		time int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, test := range tests {
+		if got := totpCode(rfc6238Key, test.time/totpPeriod); got != test.want {
+			t.Errorf("t=%d: got %s, want %s", test.time, got, test.want)
+		}
+	}
+}
+
+func TestValidateTOTPSkew(t *testing.T) {
+	secret := totpEncoding.EncodeToString(rfc6238Key)
+	now := time.Unix(1111111111, 0)
+	current := now.Unix() / totpPeriod
+
+	tests := []struct {
+		name  string
+		step  int64
+		valid bool
+	}{
+		{"current period", current, true},
+		{"previous period", current - totpSkew, true},
+		{"next period", current + totpSkew, true},
+		{"too old", current - totpSkew - 1, false},
+		{"too new", current + totpSkew + 1, false},
+	}
+	for _, test := range tests {
+		step, valid := ValidateTOTP(secret, totpCode(rfc6238Key, test.step), now)
+		if valid != test.valid || (valid && step != test.step) {
+			t.Errorf("%s: got step %d valid %v, want step %d valid %v", test.name, step, valid, test.step, test.valid)
+		}
+	}
+
+	// Codes are accepted with spaces, as some apps display them
+	code := totpCode(rfc6238Key, current)
+	if _, valid := ValidateTOTP(secret, code[:3]+" "+code[3:], now); !valid {
+		t.Error("code with a space rejected")
+	}
+	if _, valid := ValidateTOTP(secret, "12345", now); valid {
+		t.Error("5-digit code accepted")
+	}
+}
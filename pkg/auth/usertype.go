@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"context"
+
+	"agendum/internal/store"
+)
+
+// Platform roles, stored in the Users table's userType attribute
+const (
+	// UserTypeSuperadmin may change other users' types and act on any team
+	UserTypeSuperadmin = "superadmin"
+	// UserTypeStaff may use support endpoints such as unlocking logins
+	UserTypeStaff = "staff"
+	// UserTypeStandard is everyone else
+	UserTypeStandard = "standard"
+	// UserTypeService marks team-owned service accounts, which only act
+	// through access tokens
+	UserTypeService = store.ServiceUserType
+)
+
+// UserTypes lists every platform role
+var UserTypes = []string{UserTypeSuperadmin, UserTypeStaff, UserTypeStandard, UserTypeService}
+
+// ValidUserType reports whether userType is one of UserTypes
+func ValidUserType(userType string) bool {
+	for _, t := range UserTypes {
+		if t == userType {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeUserType reads a stored userType. Values from before roles were
+// defined, which users could pick themselves (such as "admin"), grant
+// nothing and count as standard.
+func NormalizeUserType(userType string) string {
+	if ValidUserType(userType) {
+		return userType
+	}
+	return UserTypeStandard
+}
+
+// PrivilegedUserType reports whether userType grants platform-wide access
+func PrivilegedUserType(userType string) bool {
+	return userType == UserTypeSuperadmin || userType == UserTypeStaff
+}
+
+// EffectiveUserType is the platform role a user acts with. Superadmins and
+// staff without two-factor authentication act as standard users until they
+// enable it.
+func EffectiveUserType(user *store.User) string {
+	if user == nil {
+		return UserTypeStandard
+	}
+	userType := NormalizeUserType(user.UserType)
+	if PrivilegedUserType(userType) && !user.MFAEnabled {
+		return UserTypeStandard
+	}
+	return userType
+}
+
+// GetUserType returns the effective platform role of a user
+func GetUserType(ctx context.Context, db *store.Store, username string) (string, error) {
+	user, err := db.Users.Get(ctx, username)
+	if err != nil {
+		return "", err
+	}
+	return EffectiveUserType(user), nil
+}
+
+// IsSuperadmin reports whether the session's user is a superadmin
+func (s *Session) IsSuperadmin() bool {
+	return s.UserType == UserTypeSuperadmin
+}
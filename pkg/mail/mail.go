@@ -0,0 +1,123 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ses"
+	"github.com/aws/aws-sdk-go-v2/service/ses/types"
+)
+
+// Message is a plain-text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers messages to users
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// NewSender picks the sender named by MAIL_SENDER:
+//   - "log" writes messages to the function's log, for development
+//   - "file" writes each message to a file in MAIL_DIR (default /tmp/mail)
+//   - "ses" sends through Amazon SES from MAIL_FROM
+//
+// Without MAIL_SENDER it defaults to ses when running in Lambda, so a
+// deployment that forgot to set it never logs reset links, and to log
+// everywhere else.
+func NewSender() (Sender, error) {
+	sender := os.Getenv("MAIL_SENDER")
+	if sender == "" {
+		sender = "log"
+		if os.Getenv("AWS_LAMBDA_FUNCTION_NAME") != "" {
+			sender = "ses"
+		}
+	}
+
+	switch sender {
+	case "log":
+		return LogSender{}, nil
+	case "file":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = filepath.Join(os.TempDir(), "mail")
+		}
+		return FileSender{Dir: dir}, nil
+	case "ses":
+		if os.Getenv("MAIL_FROM") == "" {
+			return nil, errors.New("MAIL_FROM is required when MAIL_SENDER is ses")
+		}
+		return SESSender{From: os.Getenv("MAIL_FROM")}, nil
+	}
+	return nil, fmt.Errorf("unknown MAIL_SENDER %q", sender)
+}
+
+// LogSender prints messages instead of sending them. Messages can contain
+// secrets such as reset links, so don't use it in production.
+type LogSender struct{}
+
+func (LogSender) Send(ctx context.Context, msg Message) error {
+	log.Printf("mail to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// FileSender writes each message to its own file in Dir
+type FileSender struct {
+	Dir string
+}
+
+func (s FileSender) Send(ctx context.Context, msg Message) error {
+	if err := os.MkdirAll(s.Dir, 0o700); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), strings.NewReplacer("@", "_at_", "/", "_").Replace(msg.To))
+	content := fmt.Sprintf("To: %s\nSubject: %s\n\n%s\n", msg.To, msg.Subject, msg.Body)
+	return os.WriteFile(filepath.Join(s.Dir, name), []byte(content), 0o600)
+}
+
+// SESSender sends messages through Amazon SES
+type SESSender struct {
+	From string
+}
+
+// sesClient is created on first use and shared by every send of the process
+var sesClient = sync.OnceValues(func() (*ses.Client, error) {
+	cfg, err := config.LoadDefaultConfig(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return ses.NewFromConfig(cfg), nil
+})
+
+func (s SESSender) Send(ctx context.Context, msg Message) error {
+	svc, err := sesClient()
+	if err != nil {
+		return err
+	}
+
+	_, err = svc.SendEmail(ctx, &ses.SendEmailInput{
+		Source: aws.String(s.From),
+		Destination: &types.Destination{
+			ToAddresses: []string{msg.To},
+		},
+		Message: &types.Message{
+			Subject: &types.Content{Data: aws.String(msg.Subject)},
+			Body: &types.Body{
+				Text: &types.Content{Data: aws.String(msg.Body)},
+			},
+		},
+	})
+	return err
+}
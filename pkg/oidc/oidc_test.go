@@ -0,0 +1,148 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const testClientID = "agendum-test"
+
+// testProvider serves a discovery document and a JWKS holding key under
+// the kid "key-1", and returns the discovered Provider
+func testProvider(t *testing.T, key *rsa.PrivateKey) *Provider {
+	t.Helper()
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 server.URL,
+			"authorization_endpoint": server.URL + "/authorize",
+			"token_endpoint":         server.URL + "/token",
+			"jwks_uri":               server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "key-1",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+
+	p, err := Discover(context.Background(), server.URL, testClientID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func signIDToken(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(input))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestVerify(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := testProvider(t, key)
+
+	now := time.Now()
+	claims := func(change func(map[string]interface{})) map[string]interface{} {
+		c := map[string]interface{}{
+			"iss":            p.Issuer,
+			"sub":            "subject-1",
+			"aud":            testClientID,
+			"exp":            now.Add(time.Hour).Unix(),
+			"iat":            now.Unix(),
+			"nonce":          "nonce-1",
+			"email":          "alice@example.com",
+			"email_verified": "true",
+		}
+		if change != nil {
+			change(c)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"valid", signIDToken(t, key, "key-1", claims(nil)), nil},
+		{"audience list", signIDToken(t, key, "key-1", claims(func(c map[string]interface{}) {
+			c["aud"] = []string{"someone-else", testClientID}
+		})), nil},
+		{"other issuer", signIDToken(t, key, "key-1", claims(func(c map[string]interface{}) {
+			c["iss"] = "https://evil.example.com"
+		})), ErrInvalidIDToken},
+		{"other audience", signIDToken(t, key, "key-1", claims(func(c map[string]interface{}) {
+			c["aud"] = "someone-else"
+		})), ErrInvalidIDToken},
+		{"wrong nonce", signIDToken(t, key, "key-1", claims(func(c map[string]interface{}) {
+			c["nonce"] = "nonce-2"
+		})), ErrInvalidIDToken},
+		{"expired", signIDToken(t, key, "key-1", claims(func(c map[string]interface{}) {
+			c["exp"] = now.Add(-2 * clockSkew).Unix()
+		})), ErrExpiredIDToken},
+		{"issued in the future", signIDToken(t, key, "key-1", claims(func(c map[string]interface{}) {
+			c["iat"] = now.Add(2 * clockSkew).Unix()
+		})), ErrInvalidIDToken},
+		{"unknown kid", signIDToken(t, key, "key-2", claims(nil)), ErrInvalidIDToken},
+		{"signed by another key", signIDToken(t, otherKey, "key-1", claims(nil)), ErrInvalidIDToken},
+		{"malformed", "not-a-token", ErrInvalidIDToken},
+	}
+	for _, test := range tests {
+		verified, err := p.Verify(context.Background(), test.token, "nonce-1")
+		if err != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.want)
+			continue
+		}
+		if err == nil && (verified.Subject != "subject-1" || !bool(verified.EmailVerified)) {
+			t.Errorf("%s: got claims %+v", test.name, verified)
+		}
+	}
+}
+
+func TestDiscoverCachesPerIssuer(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := testProvider(t, key)
+
+	again, err := Discover(context.Background(), p.Issuer, testClientID, "")
+	if err != nil || again != p {
+		t.Errorf("second discovery: got %p, %v, want the cached %p", again, err, p)
+	}
+}
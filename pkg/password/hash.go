@@ -0,0 +1,178 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrUnknownHash is returned for stored hashes in a format no Hasher reads
+var ErrUnknownHash = errors.New("unknown password hash format")
+
+// Hasher hashes passwords into a self-describing string, so a stored hash
+// can always be verified even after the preferred algorithm or its
+// parameters change
+type Hasher interface {
+	// Hash encodes a new hash of password
+	Hash(password string) (string, error)
+	// Verify reports whether password matches an encoded hash this Hasher
+	// recognizes
+	Verify(password, encoded string) (bool, error)
+	// Recognizes reports whether encoded is in this Hasher's format
+	Recognizes(encoded string) bool
+	// NeedsRehash reports whether encoded, in this Hasher's format, uses
+	// weaker parameters than the Hasher's own
+	NeedsRehash(encoded string) bool
+}
+
+// Argon2id hashes with argon2id into the PHC string format:
+// $argon2id$v=19$m=<KiB>,t=<passes>,p=<threads>$<salt>$<hash>
+type Argon2id struct {
+	Memory  uint32
+	Time    uint32
+	Threads uint8
+	SaltLen uint32
+	KeyLen  uint32
+}
+
+// DefaultArgon2id follows the OWASP minimum (19 MiB, 2 passes, 1 thread),
+// which fits comfortably in the smallest Lambda memory size
+var DefaultArgon2id = Argon2id{Memory: 19 * 1024, Time: 2, Threads: 1, SaltLen: 16, KeyLen: 32}
+
+func (a Argon2id) Hash(password string) (string, error) {
+	salt := make([]byte, a.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, a.Time, a.Memory, a.Threads, a.KeyLen)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, a.Memory, a.Time, a.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (a Argon2id) Verify(password, encoded string) (bool, error) {
+	params, salt, key, err := parseArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+	computed := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(computed, key) == 1, nil
+}
+
+func (a Argon2id) Recognizes(encoded string) bool {
+	return strings.HasPrefix(encoded, "$argon2id$")
+}
+
+func (a Argon2id) NeedsRehash(encoded string) bool {
+	params, salt, key, err := parseArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+	return params.Memory < a.Memory || params.Time < a.Time || params.Threads < a.Threads ||
+		uint32(len(salt)) < a.SaltLen || uint32(len(key)) < a.KeyLen
+}
+
+func parseArgon2id(encoded string) (Argon2id, []byte, []byte, error) {
+	var params Argon2id
+
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, hash
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, ErrUnknownHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported argon2id version %q", parts[2])
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads); err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2id parameters %q", parts[3])
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, err
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, err
+	}
+	return params, salt, key, nil
+}
+
+// Bcrypt hashes with bcrypt, whose $2a$<cost>$... format is already
+// self-describing. It reads every hash stored before argon2id was added.
+type Bcrypt struct {
+	Cost int
+}
+
+// DefaultBcrypt is the cost passwords were always hashed with
+var DefaultBcrypt = Bcrypt{Cost: bcrypt.DefaultCost}
+
+func (b Bcrypt) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), b.Cost)
+	return string(hash), err
+}
+
+func (b Bcrypt) Verify(password, encoded string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (b Bcrypt) Recognizes(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+func (b Bcrypt) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost < b.Cost
+}
+
+// hashers are every format Verify reads
+var hashers = []Hasher{DefaultArgon2id, DefaultBcrypt}
+
+// Preferred is the Hasher new hashes are made with. PASSWORD_HASH=bcrypt
+// keeps using bcrypt; anything else means argon2id.
+func Preferred() Hasher {
+	if os.Getenv("PASSWORD_HASH") == "bcrypt" {
+		return DefaultBcrypt
+	}
+	return DefaultArgon2id
+}
+
+// Hash hashes a new password with the preferred Hasher
+func Hash(password string) (string, error) {
+	return Preferred().Hash(password)
+}
+
+// Verify checks password against a stored hash in any supported format.
+// needsRehash is true when the password matched but the hash isn't in the
+// preferred format and parameters, so it should be replaced with Hash.
+func Verify(password, encoded string) (ok, needsRehash bool, err error) {
+	for _, h := range hashers {
+		if !h.Recognizes(encoded) {
+			continue
+		}
+		ok, err = h.Verify(password, encoded)
+		if !ok || err != nil {
+			return false, false, err
+		}
+
+		preferred := Preferred()
+		return true, !preferred.Recognizes(encoded) || preferred.NeedsRehash(encoded), nil
+	}
+	return false, false, ErrUnknownHash
+}
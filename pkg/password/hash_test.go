@@ -0,0 +1,91 @@
+package password
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const testPassword = "correct-horse-battery"
+
+func TestArgon2idRoundTrip(t *testing.T) {
+	encoded, err := DefaultArgon2id.Hash(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(encoded, "$argon2id$v=19$m=19456,t=2,p=1$") || strings.Count(encoded, "$") != 5 {
+		t.Fatalf("not a PHC string with the default parameters: %s", encoded)
+	}
+
+	params, salt, key, err := parseArgon2id(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params.Memory != DefaultArgon2id.Memory || params.Time != DefaultArgon2id.Time || params.Threads != DefaultArgon2id.Threads ||
+		uint32(len(salt)) != DefaultArgon2id.SaltLen || uint32(len(key)) != DefaultArgon2id.KeyLen {
+		t.Errorf("parsed %+v with %d-byte salt and %d-byte key", params, len(salt), len(key))
+	}
+
+	if ok, err := DefaultArgon2id.Verify(testPassword, encoded); !ok || err != nil {
+		t.Errorf("right password: got %v, %v", ok, err)
+	}
+	if ok, err := DefaultArgon2id.Verify("wrong-password-1", encoded); ok || err != nil {
+		t.Errorf("wrong password: got %v, %v", ok, err)
+	}
+	if again, _ := DefaultArgon2id.Hash(testPassword); again == encoded {
+		t.Error("two hashes of the same password share a salt")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	argon2id, err := DefaultArgon2id.Hash(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	weakArgon2id, err := Argon2id{Memory: 8 * 1024, Time: 1, Threads: 1, SaltLen: 16, KeyLen: 32}.Hash(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bcryptHash, err := DefaultBcrypt.Hash(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	weakBcrypt, err := Bcrypt{Cost: bcrypt.MinCost}.Hash(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		// hasher is PASSWORD_HASH
+		hasher      string
+		password    string
+		encoded     string
+		matched     bool
+		needsRehash bool
+	}{
+		{"argon2id", "", testPassword, argon2id, true, false},
+		{"wrong password", "", "wrong-password-1", argon2id, false, false},
+		{"weaker argon2id", "", testPassword, weakArgon2id, true, true},
+		{"bcrypt fallback", "", testPassword, bcryptHash, true, true},
+		{"bcrypt fallback, wrong password", "", "wrong-password-1", bcryptHash, false, false},
+		{"bcrypt preferred", "bcrypt", testPassword, bcryptHash, true, false},
+		{"weaker bcrypt", "bcrypt", testPassword, weakBcrypt, true, true},
+		{"argon2id with bcrypt preferred", "bcrypt", testPassword, argon2id, true, true},
+	}
+	for _, test := range tests {
+		t.Setenv("PASSWORD_HASH", test.hasher)
+		matched, needsRehash, err := Verify(test.password, test.encoded)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+		if matched != test.matched || needsRehash != test.needsRehash {
+			t.Errorf("%s: got matched %v, needsRehash %v, want %v, %v", test.name, matched, needsRehash, test.matched, test.needsRehash)
+		}
+	}
+
+	if _, _, err := Verify(testPassword, "plaintext"); err != ErrUnknownHash {
+		t.Errorf("unknown format: got %v, want ErrUnknownHash", err)
+	}
+}
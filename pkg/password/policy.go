@@ -0,0 +1,126 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// MaxBytes is the longest password bcrypt hashes; it ignores anything after
+// the first 72 bytes, so when new passwords are hashed with bcrypt
+// (PASSWORD_HASH=bcrypt) longer ones are refused rather than truncated
+const MaxBytes = 72
+
+const defaultMinLength = 10
+
+// Names of the policy rules, returned in PolicyError.Rule
+const (
+	RuleMinLength        = "min_length"
+	RuleMaxLength        = "max_length"
+	RuleContainsUsername = "contains_username"
+	RuleContainsEmail    = "contains_email"
+	RuleCommonPassword   = "common_password"
+)
+
+// PolicyError tells which rule a password broke
+type PolicyError struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func (e *PolicyError) Error() string {
+	return e.Message
+}
+
+// Policy is what a new password must satisfy
+type Policy struct {
+	MinLength int
+}
+
+// PolicyFromEnv reads the policy settings; PASSWORD_MIN_LENGTH (in
+// characters) defaults to 10
+func PolicyFromEnv() Policy {
+	p := Policy{MinLength: defaultMinLength}
+	if n, err := strconv.Atoi(os.Getenv("PASSWORD_MIN_LENGTH")); err == nil && n > 0 {
+		p.MinLength = n
+	}
+	return p
+}
+
+// Check returns a *PolicyError if the password can't be used by the account
+// with the given username and email
+func (p Policy) Check(password, username, email string) error {
+	if utf8.RuneCountInString(password) < p.MinLength {
+		return &PolicyError{RuleMinLength, fmt.Sprintf("Password must be at least %d characters long", p.MinLength)}
+	}
+	if _, bcrypt := Preferred().(Bcrypt); bcrypt && len(password) > MaxBytes {
+		return &PolicyError{RuleMaxLength, fmt.Sprintf("Password must be at most %d bytes long", MaxBytes)}
+	}
+
+	// Short usernames and email local parts like "jo" would rule out too
+	// many passwords
+	lower := strings.ToLower(password)
+	if len(username) >= 3 && strings.Contains(lower, strings.ToLower(username)) {
+		return &PolicyError{RuleContainsUsername, "Password must not contain your username"}
+	}
+	local, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(email)), "@")
+	if len(local) >= 3 && strings.Contains(lower, local) {
+		return &PolicyError{RuleContainsEmail, "Password must not contain your email address"}
+	}
+
+	if IsCommon(password) {
+		return &PolicyError{RuleCommonPassword, "Password is too common, choose a less predictable one"}
+	}
+	return nil
+}
+
+// common_passwords.txt holds the upper-case hex SHA-1 of frequently used and
+// breached passwords, one per line, so the plain passwords aren't shipped
+//
+//go:embed common_passwords.txt
+var commonPasswordsFile string
+
+var (
+	commonOnce    sync.Once
+	commonBuckets map[string]map[string]bool
+)
+
+// IsCommon reports whether the password, or its lower-case form, is in the
+// bundled list. Like the Pwned Passwords range API, hashes are grouped by
+// their first five hex characters and only that bucket is searched.
+func IsCommon(password string) bool {
+	commonOnce.Do(loadCommonPasswords)
+
+	for _, candidate := range []string{password, strings.ToLower(password)} {
+		sum := sha1.Sum([]byte(candidate))
+		hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+		if commonBuckets[hash[:5]][hash[5:]] {
+			return true
+		}
+	}
+	return false
+}
+
+func loadCommonPasswords() {
+	commonBuckets = make(map[string]map[string]bool)
+	scanner := bufio.NewScanner(strings.NewReader(commonPasswordsFile))
+	for scanner.Scan() {
+		hash := strings.ToUpper(strings.TrimSpace(scanner.Text()))
+		if len(hash) != 40 {
+			continue
+		}
+		bucket, ok := commonBuckets[hash[:5]]
+		if !ok {
+			bucket = make(map[string]bool)
+			commonBuckets[hash[:5]] = bucket
+		}
+		bucket[hash[5:]] = true
+	}
+}
@@ -0,0 +1,51 @@
+// Package secrets loads secret settings from SSM Parameter Store, so they
+// don't have to be deployed as plaintext Lambda environment variables.
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+// Names lists the environment variables holding secrets
+var Names = []string{"JWT_SIGNING_KEYS", "VERIFICATION_SIGNING_KEY", "OIDC_CLIENT_SECRET"}
+
+// Load sets each secret from the SecureString parameter named by the
+// variable of the same name suffixed with _PARAMETER, such as
+// JWT_SIGNING_KEYS_PARAMETER for JWT_SIGNING_KEYS. Secrets without one are
+// left as they are, so local runs can still set them directly. Call it once
+// at cold start, before anything reads the secrets.
+func Load(ctx context.Context) error {
+	var svc *ssm.Client
+	for _, name := range Names {
+		parameter := os.Getenv(name + "_PARAMETER")
+		if parameter == "" {
+			continue
+		}
+
+		if svc == nil {
+			cfg, err := config.LoadDefaultConfig(ctx)
+			if err != nil {
+				return err
+			}
+			svc = ssm.NewFromConfig(cfg)
+		}
+
+		result, err := svc.GetParameter(ctx, &ssm.GetParameterInput{
+			Name:           aws.String(parameter),
+			WithDecryption: aws.Bool(true),
+		})
+		if err != nil {
+			return fmt.Errorf("loading %s from %s: %w", name, parameter, err)
+		}
+		if err := os.Setenv(name, aws.ToString(result.Parameter.Value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
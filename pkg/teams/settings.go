@@ -0,0 +1,248 @@
+package teams
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	_ "time/tzdata" // Lambda runtimes don't ship a zoneinfo database
+
+	"agendum/internal/store"
+)
+
+// ErrTeamNotFound is returned when the team does not exist
+var ErrTeamNotFound = errors.New("team not found")
+
+// Weekdays lists the schedule keys in calendar order, starting on Monday
+var Weekdays = []string{"monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday"}
+
+// TimeSlot is a begin/end pair in HH:MM format
+type TimeSlot struct {
+	BeginTime string `json:"begin_time" dynamodbav:"begin_time"`
+	EndTime   string `json:"end_time" dynamodbav:"end_time"`
+}
+
+// Settings holds the team-wide defaults and constraints applied to tasks.
+// Days missing from WorkingHours are non-working days.
+type Settings struct {
+	TimeZone            string               `json:"time_zone" dynamodbav:"time_zone"`
+	WorkingHours        map[string]*TimeSlot `json:"working_hours" dynamodbav:"working_hours"`
+	WeekStart           string               `json:"week_start" dynamodbav:"week_start"`
+	DefaultTaskDuration int                  `json:"default_task_duration" dynamodbav:"default_task_duration"`
+	AllowedTaskTypes    []string             `json:"allowed_task_types" dynamodbav:"allowed_task_types"`
+}
+
+// DefaultSettings returns the settings used by teams that never saved their own
+func DefaultSettings() *Settings {
+	workingHours := make(map[string]*TimeSlot)
+	for _, day := range Weekdays[:5] {
+		workingHours[day] = &TimeSlot{BeginTime: "09:00", EndTime: "17:00"}
+	}
+
+	return &Settings{
+		TimeZone:            "UTC",
+		WorkingHours:        workingHours,
+		WeekStart:           "monday",
+		DefaultTaskDuration: 30,
+		AllowedTaskTypes:    []string{},
+	}
+}
+
+// Validate checks that every field holds a usable value
+func (s *Settings) Validate() error {
+	if _, err := time.LoadLocation(s.TimeZone); err != nil || s.TimeZone == "" || s.TimeZone == "Local" {
+		return fmt.Errorf("unknown time zone %q", s.TimeZone)
+	}
+
+	if !isWeekday(s.WeekStart) {
+		return fmt.Errorf("week_start must be a weekday name, got %q", s.WeekStart)
+	}
+
+	for day, slot := range s.WorkingHours {
+		if !isWeekday(day) {
+			return fmt.Errorf("working_hours has unknown day %q", day)
+		}
+		if slot == nil {
+			continue
+		}
+		begin, end, err := parseSlot(slot.BeginTime, slot.EndTime)
+		if err != nil {
+			return fmt.Errorf("working_hours.%s: %v", day, err)
+		}
+		if !begin.Before(end) {
+			return fmt.Errorf("working_hours.%s: begin_time must be before end_time", day)
+		}
+	}
+
+	if s.DefaultTaskDuration < 1 || s.DefaultTaskDuration > 24*60 {
+		return errors.New("default_task_duration must be between 1 and 1440 minutes")
+	}
+
+	for _, taskType := range s.AllowedTaskTypes {
+		if strings.TrimSpace(taskType) == "" {
+			return errors.New("allowed_task_types cannot contain empty values")
+		}
+	}
+
+	return nil
+}
+
+// OrderedWeekdays returns the weekday names starting on the team's first day of week
+func (s *Settings) OrderedWeekdays() []string {
+	start := 0
+	for i, day := range Weekdays {
+		if day == s.WeekStart {
+			start = i
+		}
+	}
+	return append(append([]string{}, Weekdays[start:]...), Weekdays[:start]...)
+}
+
+// DefaultEndTime returns the end time of a task starting at begin that lasts
+// the team's default task duration
+func (s *Settings) DefaultEndTime(begin string) (string, error) {
+	t, err := time.Parse("15:04", begin)
+	if err != nil {
+		return "", fmt.Errorf("invalid time %q, expected HH:MM", begin)
+	}
+	end := t.Add(time.Duration(s.DefaultTaskDuration) * time.Minute)
+	if end.Day() != t.Day() {
+		return "", fmt.Errorf("a %d minute task starting at %s ends after midnight", s.DefaultTaskDuration, begin)
+	}
+	return end.Format("15:04"), nil
+}
+
+// CheckTaskType verifies the task type is allowed. An empty allow list permits any type.
+func (s *Settings) CheckTaskType(taskType string) error {
+	if len(s.AllowedTaskTypes) == 0 {
+		return nil
+	}
+	for _, allowed := range s.AllowedTaskTypes {
+		if allowed == taskType {
+			return nil
+		}
+	}
+	return fmt.Errorf("task type %q is not allowed, expected one of: %s", taskType, strings.Join(s.AllowedTaskTypes, ", "))
+}
+
+// CheckSlot verifies a task slot falls on a working day within working hours
+func (s *Settings) CheckSlot(day, beginTime, endTime string) error {
+	begin, end, err := parseSlot(beginTime, endTime)
+	if err != nil {
+		return fmt.Errorf("%s: %v", day, err)
+	}
+	if !begin.Before(end) {
+		return fmt.Errorf("%s: begin_time must be before end_time", day)
+	}
+
+	hours, ok := s.WorkingHours[day]
+	if !ok || hours == nil {
+		return fmt.Errorf("%s is not a working day for this team", day)
+	}
+	workBegin, workEnd, _ := parseSlot(hours.BeginTime, hours.EndTime)
+	if begin.Before(workBegin) || end.After(workEnd) {
+		return fmt.Errorf("%s: %s-%s is outside working hours %s-%s", day, beginTime, endTime, hours.BeginTime, hours.EndTime)
+	}
+
+	return nil
+}
+
+// ConvertSlot converts a weekly slot given in the time zone timeZone into
+// the team's time zone, returning the day and times it falls on there. The
+// offset between the zones is the one at the slot's next occurrence after
+// now. A slot that spans midnight once converted is rejected, as no working
+// hours can contain it.
+func (s *Settings) ConvertSlot(timeZone, day, beginTime, endTime string, now time.Time) (string, string, string, error) {
+	from, err := time.LoadLocation(timeZone)
+	if err != nil {
+		return "", "", "", fmt.Errorf("unknown time zone %q", timeZone)
+	}
+	to, err := time.LoadLocation(s.TimeZone)
+	if err != nil {
+		return "", "", "", fmt.Errorf("unknown time zone %q", s.TimeZone)
+	}
+	begin, end, err := parseSlot(beginTime, endTime)
+	if err != nil {
+		return "", "", "", fmt.Errorf("%s: %v", day, err)
+	}
+
+	// Weekdays starts on Monday, time.Weekday on Sunday
+	weekday := time.Weekday(0)
+	for i, d := range Weekdays {
+		if d == day {
+			weekday = time.Weekday((i + 1) % 7)
+		}
+	}
+	local := now.In(from)
+	date := local.AddDate(0, 0, (int(weekday)-int(local.Weekday())+7)%7)
+	at := func(t time.Time) time.Time {
+		return time.Date(date.Year(), date.Month(), date.Day(), t.Hour(), t.Minute(), 0, 0, from).In(to)
+	}
+	convertedBegin, convertedEnd := at(begin), at(end)
+
+	convertedDay := strings.ToLower(convertedBegin.Weekday().String())
+	if convertedEnd.Day() != convertedBegin.Day() {
+		return "", "", "", fmt.Errorf("%s: %s-%s in %s spans midnight in the team's time zone %s", day, beginTime, endTime, timeZone, s.TimeZone)
+	}
+	return convertedDay, convertedBegin.Format("15:04"), convertedEnd.Format("15:04"), nil
+}
+
+// GetSettings loads a team's settings, falling back to DefaultSettings when
+// none were saved. saved reports whether the team saved its own settings;
+// only those are enforced on tasks.
+func GetSettings(ctx context.Context, db *store.Store, teamID string) (settings *Settings, saved bool, err error) {
+	// Saved settings are decoded over the defaults, except for the working
+	// hours, where a missing day means a day off
+	settings = DefaultSettings()
+	settings.WorkingHours = nil
+	found, err := db.Teams.Settings(ctx, teamID, settings)
+	if err == store.ErrNotFound {
+		return nil, false, ErrTeamNotFound
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if !found {
+		return DefaultSettings(), false, nil
+	}
+
+	if settings.WorkingHours == nil {
+		settings.WorkingHours = make(map[string]*TimeSlot)
+	}
+	if settings.AllowedTaskTypes == nil {
+		settings.AllowedTaskTypes = []string{}
+	}
+
+	return settings, true, nil
+}
+
+// SaveSettings replaces a team's settings document
+func SaveSettings(ctx context.Context, db *store.Store, teamID string, settings *Settings) error {
+	err := db.Teams.SaveSettings(ctx, teamID, settings)
+	if err == store.ErrNotFound {
+		return ErrTeamNotFound
+	}
+	return err
+}
+
+func isWeekday(day string) bool {
+	for _, d := range Weekdays {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+func parseSlot(beginTime, endTime string) (time.Time, time.Time, error) {
+	begin, err := time.Parse("15:04", beginTime)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid begin_time %q, expected HH:MM", beginTime)
+	}
+	end, err := time.Parse("15:04", endTime)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid end_time %q, expected HH:MM", endTime)
+	}
+	return begin, end, nil
+}
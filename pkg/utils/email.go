@@ -0,0 +1,9 @@
+package utils
+
+import "strings"
+
+// NormalizeEmail lower-cases an email address and strips surrounding whitespace
+// so lookups and uniqueness checks don't depend on how the user typed it
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}